@@ -0,0 +1,143 @@
+// Command annrecall reports how closely the IVF index agrees with a brute-force
+// search, and how much faster it is, across a range of nprobe settings.
+//
+//	go run ./cmd/annrecall -k 50 -queries 200
+//
+// Queries are corpus vectors with a little gaussian noise added, or, with
+// -query-file, real queries embedded through the configured provider.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/index"
+	"go-scripture/pkg/similarity"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	godotenv.Load()
+	chapterFile := flag.String("chapter", "embeddingsData/chapter/KJV_Bible_Embeddings_by_Chapter.csv", "chapter embeddings dataset")
+	verseFile := flag.String("verse", "embeddingsData/verse/KJV_Bible_Embeddings.csv", "verse embeddings dataset")
+	k := flag.Int("k", 50, "number of neighbours compared")
+	numQueries := flag.Int("queries", 200, "number of sampled queries")
+	noise := flag.Float64("noise", 0.01, "standard deviation of noise added to sampled queries")
+	queryFile := flag.String("query-file", "", "file of text queries, one per line, embedded with the configured provider")
+	flag.Parse()
+
+	embeddingsByChapter, embeddingsByVerse, err := embeddings.LoadEmbeddings(*chapterFile, *verseFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	corpus := similarity.NewCorpus(embeddingsByChapter, embeddingsByVerse)
+	corpus.LoadOrBuildIndexes(similarity.IndexPath(*chapterFile), similarity.IndexPath(*verseFile))
+
+	for _, set := range []struct {
+		name   string
+		corpus []similarity.Embedding
+		ivf    *index.IVF
+	}{
+		{"chapter", corpus.Chapters, corpus.ChapterIndex},
+		{"verse", corpus.Verses, corpus.VerseIndex},
+	} {
+		vectors := make([][]float32, len(set.corpus))
+		for i, e := range set.corpus {
+			vectors[i] = e.Embedding
+		}
+		queries, err := loadQueries(*queryFile, vectors, *numQueries, *noise)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		report(set.name, set.ivf, vectors, queries, *k)
+	}
+}
+
+func loadQueries(queryFile string, vectors [][]float32, n int, noise float64) ([][]float32, error) {
+	if queryFile == "" {
+		rng := rand.New(rand.NewSource(1))
+		queries := make([][]float32, n)
+		for i := range queries {
+			base := vectors[rng.Intn(len(vectors))]
+			q := make([]float32, len(base))
+			for d := range base {
+				q[d] = base[d] + float32(rng.NormFloat64()*noise)
+			}
+			queries[i] = q
+		}
+		return queries, nil
+	}
+
+	f, err := os.Open(queryFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var texts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if t := strings.TrimSpace(scanner.Text()); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	embedder, err := embeddings.NewEmbedderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	vectors64, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		return nil, err
+	}
+	queries := make([][]float32, len(vectors64))
+	for i, v := range vectors64 {
+		queries[i] = embeddings.ToFloat32(v)
+	}
+	return queries, nil
+}
+
+func report(name string, ivf *index.IVF, vectors [][]float32, queries [][]float32, k int) {
+	exact := make([]map[int]bool, len(queries))
+	start := time.Now()
+	for i, q := range queries {
+		exact[i] = make(map[int]bool, k)
+		for _, r := range index.BruteForce(vectors, q, k) {
+			exact[i][r.ID] = true
+		}
+	}
+	bruteTime := time.Since(start) / time.Duration(len(queries))
+
+	fmt.Printf("%s: %d vectors, %d lists, k=%d, %d queries, brute force %s/query\n",
+		name, ivf.Len(), ivf.NList(), k, len(queries), bruteTime)
+	fmt.Printf("  %8s %8s %12s %8s\n", "nprobe", "recall", "time/query", "speedup")
+	for nprobe := 1; nprobe <= ivf.NList(); nprobe *= 2 {
+		found, expected := 0, 0
+		start := time.Now()
+		for i, q := range queries {
+			for _, r := range ivf.Search(q, k, nprobe) {
+				if exact[i][r.ID] {
+					found++
+				}
+			}
+			expected += len(exact[i])
+		}
+		annTime := time.Since(start) / time.Duration(len(queries))
+		marker := ""
+		if nprobe == ivf.NProbe {
+			marker = " (default)"
+		}
+		fmt.Printf("  %8d %8.3f %12s %7.1fx%s\n", nprobe, float64(found)/float64(expected), annTime, float64(bruteTime)/float64(annTime), marker)
+	}
+}
@@ -0,0 +1,35 @@
+// Command convert turns the chapter and verse embedding CSVs into the binary
+// dataset format that the API loads at startup.
+//
+//	go run ./cmd/convert -chapter embeddingsData/chapter/KJV_Bible_Embeddings_by_Chapter.csv \
+//		-verse embeddingsData/verse/KJV_Bible_Embeddings.csv
+//
+// Each output is written next to its input with a .bin extension.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"os"
+)
+
+func main() {
+	chapterCSV := flag.String("chapter", "embeddingsData/chapter/KJV_Bible_Embeddings_by_Chapter.csv", "chapter embeddings CSV")
+	verseCSV := flag.String("verse", "embeddingsData/verse/KJV_Bible_Embeddings.csv", "verse embeddings CSV")
+	model := flag.String("model", "text-embedding-ada-002", "model that produced the embeddings")
+	flag.Parse()
+
+	for _, in := range []struct{ file, db string }{{*chapterCSV, "chapter"}, {*verseCSV, "verse"}} {
+		if in.file == "" {
+			continue
+		}
+		out := embeddings.BinaryPath(in.file)
+		n, err := embeddings.ConvertCSVToBinary(in.file, in.db, out, *model)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "converting %s: %s\n", in.file, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %d %s embeddings to %s\n", n, in.db, out)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go-scripture/pkg/api"
 	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/index"
 	"go-scripture/pkg/similarity"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -15,47 +20,187 @@ import (
 func main() {
 	godotenv.Load()
 	e := echo.New()
+	e.HTTPErrorHandler = api.HandleError
 
 	e.Use(middleware.Logger())
 
-	fmt.Println("Loading embeddings...")
-	embeddingsByChapter, embeddingsByVerse := embeddings.LoadEmbeddings("embeddingsData/chapter/KJV_Bible_Embeddings_by_Chapter.csv", "embeddingsData/verse/KJV_Bible_Embeddings.csv")
-	fmt.Println("Embeddings loaded")
+	provider, err := embeddings.NewEmbedderFromEnv()
+	if err != nil {
+		fmt.Printf("Semantic search unavailable: %s\n", err)
+		provider = embeddings.NewUnavailableEmbedder(err)
+	}
+	embedder, err := embeddings.NewCachedEmbedderFromEnv(provider)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	defer embedder.Close()
+	fmt.Printf("Using embedding model %s\n", embedder.Model())
 
-	fmt.Printf("Building verse map...\n")
-	verseMap := similarity.BuildVerseMap(embeddingsByVerse)
-	fmt.Printf("Verse map built\n")
+	if warmFile := os.Getenv("EMBEDDING_CACHE_WARM"); warmFile != "" {
+		fmt.Println("Warming query embedding cache...")
+		n, err := embedder.WarmFromFile(context.Background(), warmFile)
+		if err != nil {
+			fmt.Printf("Error warming embedding cache: %s\n", err)
+		} else {
+			fmt.Printf("Embedding cache warmed with %d queries\n", n)
+		}
+	}
+
+	translations := loadTranslations(os.Getenv("TRANSLATIONS"), embedder.Model())
+	if translations.Default() == nil {
+		e.Logger.Fatal("no translations loaded")
+	}
 
 	e.GET("/", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"message": "Hello World"})
 	})
 
 	e.GET("/search/verse", func(c echo.Context) error {
-		return api.HandleSearchByVerse(c, embeddingsByChapter, embeddingsByVerse, verseMap)
+		return api.HandleSearchByVerse(c, translations, embedder)
 	})
 
 	e.GET("/search/chapter", func(c echo.Context) error {
-		return api.HandleSearchByChapter(c, embeddingsByChapter, embeddingsByVerse, verseMap)
+		return api.HandleSearchByChapter(c, translations, embedder)
 	})
 
 	e.GET("/search/passage", func(c echo.Context) error {
-		return api.HandleSearchByPassage(c, embeddingsByChapter, embeddingsByVerse, verseMap)
+		return api.HandleSearchByPassage(c, translations, embedder)
 	})
 
 	e.GET("/search", func(c echo.Context) error {
-		return api.HandleQuery(c, embeddingsByChapter, embeddingsByVerse, verseMap)
+		return api.HandleQuery(c, translations, embedder)
 	})
 
 	e.GET("/search/all", func(c echo.Context) error {
-		return api.HandleSearchAll(c, embeddingsByChapter, embeddingsByVerse, verseMap)
+		return api.HandleSearchAll(c, translations, embedder)
+	})
+
+	e.GET("/search/keyword", func(c echo.Context) error {
+		return api.HandleKeywordSearch(c, translations)
+	})
+
+	e.GET("/search/quote", func(c echo.Context) error {
+		return api.HandleQuoteSearch(c, translations)
+	})
+
+	e.GET("/translations", func(c echo.Context) error {
+		return api.HandleTranslations(c, translations)
+	})
+
+	e.GET("/cache/stats", func(c echo.Context) error {
+		return api.HandleCacheStats(c, embedder)
 	})
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{http.MethodGet},
 		AllowHeaders:     []string{"*"},
+		ExposeHeaders:    []string{"X-Total-Count", "X-Total-Approximate", "X-Reference"},
 		AllowCredentials: true,
 	}))
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
+
+// loadTranslations loads every translation in spec, a comma-separated list of
+// ids such as "KJV,ASV,WEB:KJV" (default "KJV"). The first is the default. A
+// translation with embeddings of its own is read from the embeddingsData chapter
+// and verse datasets; one written "ID:SOURCE", or without embeddings, is read
+// from embeddingsData/text/ID_Bible.csv and searched with the vectors of SOURCE
+// (default: the first translation loaded with its own embeddings).
+func loadTranslations(spec string, queryModel string) *similarity.Translations {
+	if spec == "" {
+		spec = "KJV"
+	}
+	translations := similarity.NewTranslations()
+	type aligned struct{ id, source string }
+	var pending []aligned
+	defaultID := ""
+
+	for _, entry := range strings.Split(spec, ",") {
+		id, source, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if id == "" {
+			continue
+		}
+		if defaultID == "" {
+			defaultID = id
+		}
+		chapterFile := fmt.Sprintf("embeddingsData/chapter/%s_Bible_Embeddings_by_Chapter.csv", id)
+		verseFile := fmt.Sprintf("embeddingsData/verse/%s_Bible_Embeddings.csv", id)
+		if source != "" || !datasetExists(verseFile) {
+			pending = append(pending, aligned{id, source})
+			continue
+		}
+
+		fmt.Printf("Loading %s embeddings...\n", id)
+		embeddingsByChapter, embeddingsByVerse, err := embeddings.LoadEmbeddings(chapterFile, verseFile)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", id, err)
+			continue
+		}
+		for _, file := range []string{chapterFile, verseFile} {
+			if model, ok := embeddings.DatasetModel(file); ok && queryModel != "" && model != queryModel {
+				fmt.Printf("Warning: %s was embedded with %s but queries are embedded with %s, so semantic scores will be meaningless\n", embeddings.BinaryPath(file), model, queryModel)
+			}
+		}
+		corpus := similarity.NewCorpus(embeddingsByChapter, embeddingsByVerse)
+		corpus.LoadVersification(similarity.VersificationPath(verseFile))
+		if os.Getenv("ANN_INDEX") != "off" {
+			fmt.Printf("Loading %s ANN indexes...\n", id)
+			corpus.LoadOrBuildIndexes(similarity.IndexPath(chapterFile), similarity.IndexPath(verseFile))
+		}
+		translations.Add(id, corpus)
+		fmt.Printf("%s loaded\n", id)
+	}
+
+	for _, a := range pending {
+		source, ok := translations.Get(a.source)
+		if !ok || source == nil {
+			fmt.Printf("Skipping %s: no embeddings to align it with\n", a.id)
+			continue
+		}
+		textFile := fmt.Sprintf("embeddingsData/text/%s_Bible.csv", a.id)
+		if !datasetExists(textFile) {
+			fmt.Printf("Skipping %s: %s not found\n", a.id, textFile)
+			continue
+		}
+
+		fmt.Printf("Loading %s text aligned with %s embeddings...\n", a.id, source.Translation)
+		verses, err := embeddings.LoadVerseTexts(textFile)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", a.id, err)
+			continue
+		}
+		corpus := similarity.NewAlignedCorpus(verses, source)
+		corpus.LoadVersification(similarity.VersificationPath(textFile))
+		if os.Getenv("ANN_INDEX") != "off" {
+			base := strings.TrimSuffix(textFile, ".csv")
+			corpus.LoadOrBuildIndexes(similarity.IndexPath(base+"_by_Chapter.csv"), similarity.IndexPath(textFile))
+		}
+		translations.Add(a.id, corpus)
+		fmt.Printf("%s loaded\n", a.id)
+	}
+	translations.SetDefault(defaultID)
+
+	if nprobe, err := strconv.Atoi(os.Getenv("ANN_NPROBE")); err == nil && nprobe > 0 {
+		for _, id := range translations.IDs() {
+			corpus, _ := translations.Get(id)
+			for _, idx := range []*index.IVF{corpus.ChapterIndex, corpus.VerseIndex} {
+				if idx != nil {
+					idx.NProbe = nprobe
+				}
+			}
+		}
+	}
+	return translations
+}
+
+// datasetExists reports whether a dataset CSV, or its binary conversion, exists.
+func datasetExists(csvFile string) bool {
+	for _, file := range []string{csvFile, embeddings.BinaryPath(csvFile)} {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package api
 import (
 	"fmt"
 	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/reference"
 	"go-scripture/pkg/similarity"
+	"math"
 	"net/http"
-	"sort"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
@@ -26,141 +28,372 @@ type Tuple struct {
 	First  int
 	Second float64
 }
-type SearchOutput struct {
-	Index        int     `json:"index"`
-	Location     string  `json:"location"`
-	Verse        string  `json:"verse"`
-	Similarities float64 `json:"similarities"`
-}
-
-func HandleSearchByVerse(c echo.Context, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) error {
-	book := c.QueryParam("book")
-	chapter := c.QueryParam("chapter")
-	verse := c.QueryParam("verse")
-	locationQuery := fmt.Sprintf("%s %s:%s", book, chapter, verse)
 
-	found := similarity.FindSimilarities(locationQuery, embeddingsByChapter, embeddingsByVerse, verseMap, "verse", make([]float64, 0))
+func HandleSearchByVerse(c echo.Context, translations *similarity.Translations, embedder embeddings.Embedder) error {
+	meta := startSearch()
+	opts, err := parseSearchOptions(c, similarity.ReferenceForce)
+	if err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+	book, err := bookParam(c)
+	if err != nil {
+		return err
+	}
+	chapter, err := positiveIntParam(c, "chapter")
+	if err != nil {
+		return err
+	}
+	verse, err := positiveIntParam(c, "verse")
+	if err != nil {
+		return err
+	}
+	ref := reference.Reference{Book: book, Ranges: []reference.Range{{StartChapter: chapter, StartVerse: verse, EndChapter: chapter, EndVerse: verse}}}
+	if err := checkReference(c, corpus, ref); err != nil {
+		return err
+	}
+	locationQuery := ref.String()
+	meta.query, meta.reference, meta.mode, meta.model = locationQuery, locationQuery, string(opts.Mode), embedder.Model()
 
-	var searchResults []SearchOutput
-	for i, e := range found {
-		searchResults = append(searchResults, SearchOutput{
-			Index:        i,
-			Location:     e.Location,
-			Verse:        e.Verse,
-			Similarities: e.Similarity,
-		})
+	loc, err := similarity.DetectLocation(locationQuery, corpus, opts.ReferenceMode)
+	if err != nil {
+		return err
+	}
+	meta.approximate = corpus.Approximate("verse", opts)
+	found, total, err := similarity.FindSimilarities(locationQuery, loc, corpus, embedder, "verse", make([]float32, 0), opts)
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("Search by verse: %s", locationQuery)
-	return c.JSON(http.StatusOK, searchResults)
+	return respondWithResults(c, meta, corpus, parallel, found, total, opts.Offset)
 }
 
-func HandleSearchByChapter(c echo.Context, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) error {
-	book := c.QueryParam("book")
-	chapter := c.QueryParam("chapter")
-	locationQuery := fmt.Sprintf("%s %s", book, chapter)
-
-	found := similarity.FindSimilarities(locationQuery, embeddingsByChapter, embeddingsByVerse, verseMap, "chapter", make([]float64, 0))
+func HandleSearchByChapter(c echo.Context, translations *similarity.Translations, embedder embeddings.Embedder) error {
+	meta := startSearch()
+	opts, err := parseSearchOptions(c, similarity.ReferenceForce)
+	if err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+	book, err := bookParam(c)
+	if err != nil {
+		return err
+	}
+	chapter, err := positiveIntParam(c, "chapter")
+	if err != nil {
+		return err
+	}
+	ref := reference.Reference{Book: book, Ranges: []reference.Range{{StartChapter: chapter, EndChapter: chapter}}}
+	if err := checkReference(c, corpus, ref); err != nil {
+		return err
+	}
+	locationQuery := ref.String()
+	meta.query, meta.reference, meta.mode, meta.model = locationQuery, locationQuery, string(opts.Mode), embedder.Model()
 
-	var searchResults []SearchOutput
-	for i, e := range found {
-		searchResults = append(searchResults, SearchOutput{
-			Index:        i,
-			Location:     e.Location,
-			Verse:        e.Verse,
-			Similarities: e.Similarity,
-		})
+	loc, err := similarity.DetectLocation(locationQuery, corpus, opts.ReferenceMode)
+	if err != nil {
+		return err
+	}
+	meta.approximate = corpus.Approximate("chapter", opts)
+	found, total, err := similarity.FindSimilarities(locationQuery, loc, corpus, embedder, "chapter", make([]float32, 0), opts)
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("Search by chapter: %s", locationQuery)
-	return c.JSON(http.StatusOK, searchResults)
+	return respondWithResults(c, meta, corpus, parallel, found, total, opts.Offset)
 }
 
-func HandleSearchByPassage(c echo.Context, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) error {
-	book := c.QueryParam("book")
-	chapter := c.QueryParam("chapter")
-	verseStart := c.QueryParam("verseStart")
-	verseEnd := c.QueryParam("verseEnd")
-	locationQuery := fmt.Sprintf("%s %s:%s-%s", book, chapter, verseStart, verseEnd)
-
-	found := similarity.FindSimilarities(locationQuery, embeddingsByChapter, embeddingsByVerse, verseMap, "passage", make([]float64, 0))
-	found = similarity.FindBestPassages(found, 2, 200)
-	found = similarity.MergePassageResults(found, locationQuery, verseMap)
+func HandleSearchByPassage(c echo.Context, translations *similarity.Translations, embedder embeddings.Embedder) error {
+	meta := startSearch()
+	opts, err := parseSearchOptions(c, similarity.ReferenceForce)
+	if err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+	passageOpts, err := parsePassageOptions(c)
+	if err != nil {
+		return err
+	}
+	book, err := bookParam(c)
+	if err != nil {
+		return err
+	}
+	rg := reference.Range{}
+	if rg.StartChapter, err = positiveIntParam(c, "chapter"); err != nil {
+		return err
+	}
+	if rg.StartVerse, err = positiveIntParam(c, "verseStart"); err != nil {
+		return err
+	}
+	if rg.EndVerse, err = positiveIntParam(c, "verseEnd"); err != nil {
+		return err
+	}
+	rg.EndChapter = rg.StartChapter
+	if c.QueryParam("chapterEnd") != "" {
+		if rg.EndChapter, err = positiveIntParam(c, "chapterEnd"); err != nil {
+			return err
+		}
+	}
+	if rg.EndChapter < rg.StartChapter || (rg.EndChapter == rg.StartChapter && rg.EndVerse < rg.StartVerse) {
+		return echo.NewHTTPError(http.StatusBadRequest, "The passage must not end before it starts")
+	}
+	ref := reference.Reference{Book: book, Ranges: []reference.Range{rg}}
+	if err := checkReference(c, corpus, ref); err != nil {
+		return err
+	}
+	locationQuery := ref.String()
+	meta.query, meta.reference, meta.mode, meta.model = locationQuery, locationQuery, string(opts.Mode), embedder.Model()
 
-	var searchResults []SearchOutput
-	for i, e := range found {
-		searchResults = append(searchResults, SearchOutput{
-			Index:        i,
-			Location:     e.Location,
-			Verse:        e.Verse,
-			Similarities: e.Similarity,
-		})
+	loc, err := similarity.DetectLocation(locationQuery, corpus, opts.ReferenceMode)
+	if err != nil {
+		return err
 	}
+	found, _, err := similarity.FindSimilarities(locationQuery, loc, corpus, embedder, "passage", make([]float32, 0), passageVerseScores(opts))
+	if err != nil {
+		return err
+	}
+	found = similarity.FindPassages(found, loc, corpus, passageOpts)
+	found, total := similarity.Paginate(found, opts)
 
 	fmt.Printf("Search by passage: %s", locationQuery)
-	return c.JSON(http.StatusOK, searchResults)
+	return respondWithResults(c, meta, corpus, parallel, found, total, opts.Offset)
 }
 
-func HandleQuery(c echo.Context, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) error {
+func HandleQuery(c echo.Context, translations *similarity.Translations, embedder embeddings.Embedder) error {
+	meta := startSearch()
 	searchBy := c.QueryParam("search_by")
 	query := c.QueryParam("query")
 
 	if searchBy == "" || query == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Missing query parameters 'search_by' and 'query'")
 	}
+	opts, err := parseSearchOptions(c, similarity.ReferenceAuto)
+	if err != nil {
+		return err
+	}
+	if query, err = parseQuery(query, &opts); err != nil {
+		return err
+	}
+	if opts.Diversity, err = parseDiversity(c); err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+	meta.query, meta.model = normalizeQuery(query), embedder.Model()
 
-	found := similarity.FindSimilarities(query, embeddingsByChapter, embeddingsByVerse, verseMap, searchBy, make([]float64, 0))
+	loc, err := similarity.DetectLocation(query, corpus, opts.ReferenceMode)
+	if err != nil {
+		return err
+	}
 
-	if searchBy == "passage" {
-		found = similarity.FindBestPassages(found, 2, 200)
-		found = similarity.MergePassageResults(found, query, verseMap)
-	} else {
-		found = found[:50]
+	// A query that reads as a quotation is answered with the verses it quotes.
+	if (searchBy == "verse" || searchBy == "passage") && c.QueryParam("quote") != "off" {
+		if quotes, total, ok := similarity.MatchQuote(query, loc, corpus, opts); ok {
+			meta.mode = "quote"
+			fmt.Printf("Search by: %s, Quote: %s\n", searchBy, query)
+			return respondWithQuotes(c, meta, corpus, parallel, quotes, total, opts.Offset)
+		}
 	}
 
-	var searchResults []SearchOutput
-	for i, e := range found {
-		searchResults = append(searchResults, SearchOutput{
-			Index:        i,
-			Location:     e.Location,
-			Verse:        e.Verse,
-			Similarities: e.Similarity,
-		})
+	meta.mode, meta.reference = string(opts.Mode), loc.LocationString
+	var found []Embedding
+	var total int
+	if searchBy == "passage" {
+		passageOpts, err := parsePassageOptions(c)
+		if err != nil {
+			return err
+		}
+		if found, _, err = similarity.FindSimilarities(query, loc, corpus, embedder, searchBy, make([]float32, 0), passageVerseScores(opts)); err != nil {
+			return err
+		}
+		found = similarity.FindPassages(found, loc, corpus, passageOpts)
+		found, total = similarity.Paginate(found, opts)
+	} else {
+		meta.approximate = corpus.Approximate(searchBy, opts)
+		if found, total, err = similarity.FindSimilarities(query, loc, corpus, embedder, searchBy, make([]float32, 0), opts); err != nil {
+			return err
+		}
 	}
 
 	fmt.Printf("Search by: %s, Query: %s\n", searchBy, query)
-	return c.JSON(http.StatusOK, searchResults)
+	return respondWithResults(c, meta, corpus, parallel, found, total, opts.Offset)
 }
 
-func HandleSearchAll(c echo.Context, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) error {
+func HandleSearchAll(c echo.Context, translations *similarity.Translations, embedder embeddings.Embedder) error {
+	meta := startSearch()
 	query := c.QueryParam("query")
-	searchTermVector := similarity.IfSearchNotExists(query, embeddingsByChapter, embeddingsByVerse, verseMap)
+	opts, err := parseSearchOptions(c, similarity.ReferenceAuto)
+	if err != nil {
+		return err
+	}
+	if query, err = parseQuery(query, &opts); err != nil {
+		return err
+	}
+	if opts.Diversity, err = parseDiversity(c); err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+	passageOpts, err := parsePassageOptions(c)
+	if err != nil {
+		return err
+	}
+	// Scores here are standard scores, for which the default cut-off of -1
+	// would drop results.
+	if c.QueryParam("min_score") == "" {
+		opts.MinScore = math.Inf(-1)
+	}
+	meta.query, meta.mode, meta.model = normalizeQuery(query), string(opts.Mode), embedder.Model()
+	loc, err := similarity.DetectLocation(query, corpus, opts.ReferenceMode)
+	if err != nil {
+		return err
+	}
+	meta.reference = loc.LocationString
+	searchTermVector, err := similarity.IfSearchNotExists(query, loc, corpus, embedder)
+	if err != nil {
+		return err
+	}
 
-	passageFound := similarity.FindSimilarities(query, embeddingsByChapter, embeddingsByVerse, verseMap, "passage", searchTermVector)
-	passageFound = similarity.FindBestPassages(passageFound, 2, 200)
-	passageFound = similarity.MergePassageResults(passageFound, query, verseMap)
+	// Passage detection scores every verse, which also gives the distribution
+	// verse scores are standardized against. The verse and chapter results
+	// themselves come from the usual bounded search, down to the end of the
+	// page.
+	verseScores, _, err := similarity.FindSimilarities(query, loc, corpus, embedder, "passage", searchTermVector, passageVerseScores(opts))
+	if err != nil {
+		return err
+	}
+	passageFound := similarity.FindPassages(verseScores, loc, corpus, passageOpts)
+	verseStats := similarity.StatsOf(verseScores)
+	verseStats.Standardize(passageFound)
 
-	verseFound := similarity.FindSimilarities(query, embeddingsByChapter, embeddingsByVerse, verseMap, "verse", searchTermVector)
+	var verseFound []Embedding
+	if opts.Mode == similarity.ModeHybrid {
+		// Fused scores are on a scale of their own, so every fused verse is
+		// needed for their distribution; there are at most a few thousand.
+		fused, _, err := similarity.FindSimilarities(query, loc, corpus, embedder, "verse", searchTermVector, everyResult(opts))
+		if err != nil {
+			return err
+		}
+		verseStats = similarity.StatsOf(fused)
+		verseFound, _ = similarity.Paginate(fused, headOf(opts))
+	} else if verseFound, _, err = similarity.FindSimilarities(query, loc, corpus, embedder, "verse", searchTermVector, headOf(opts)); err != nil {
+		return err
+	}
+	verseStats.Standardize(verseFound)
 
-	chapterFound := similarity.FindSimilarities(query, embeddingsByChapter, embeddingsByVerse, verseMap, "chapter", searchTermVector)
+	chapterFound, _, err := similarity.FindSimilarities(query, loc, corpus, embedder, "chapter", searchTermVector, headOf(opts))
+	if err != nil {
+		return err
+	}
+	chapterStats, err := similarity.ChapterStats(corpus, searchTermVector, opts.Filter)
+	if err != nil {
+		return err
+	}
+	chapterStats.Standardize(chapterFound)
 
-	// Combine all results and sort them by similarity
 	allFound := append(verseFound, append(chapterFound, passageFound...)...)
-	sort.Slice(allFound, func(i, j int) bool {
-		return allFound[i].Similarity > allFound[j].Similarity
-	})
-	allFound = allFound[:50]
+	merged, total := similarity.MergeResults(allFound, corpus.Versification, opts)
 
-	var searchResults []SearchOutput
-	for i, e := range allFound {
-		searchResults = append(searchResults, SearchOutput{
-			Index:        i,
-			Location:     e.Location,
-			Verse:        e.Verse,
-			Similarities: e.Similarity,
-		})
+	fmt.Printf("Search All by: %s\n", query)
+	return respondWithMerged(c, meta, corpus, parallel, merged, total, opts.Offset)
+}
+
+func HandleKeywordSearch(c echo.Context, translations *similarity.Translations) error {
+	meta := startSearch()
+	query := c.QueryParam("query")
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing query parameter 'query'")
+	}
+	opts, err := parseSearchOptions(c, similarity.ReferenceOff)
+	if err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Search All by: %s\n", query)
-	return c.JSON(http.StatusOK, searchResults)
+	found, total := similarity.FindKeywordMatches(query, corpus, opts)
+	meta.query, meta.mode = normalizeQuery(query), "keyword"
+
+	fmt.Printf("Keyword search: %s\n", query)
+	return respondWithResults(c, meta, corpus, parallel, found, total, opts.Offset)
+}
+
+func HandleQuoteSearch(c echo.Context, translations *similarity.Translations) error {
+	meta := startSearch()
+	query := c.QueryParam("query")
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing query parameter 'query'")
+	}
+	opts, err := parseSearchOptions(c, similarity.ReferenceOff)
+	if err != nil {
+		return err
+	}
+	corpus, err := corpusFor(c, translations)
+	if err != nil {
+		return err
+	}
+	parallel, err := parallelCorpora(c, translations)
+	if err != nil {
+		return err
+	}
+
+	quotes, total := similarity.FindQuotes(query, corpus, opts)
+	meta.query, meta.mode = normalizeQuery(query), "quote"
+
+	fmt.Printf("Quote search: %s\n", query)
+	return respondWithQuotes(c, meta, corpus, parallel, quotes, total, opts.Offset)
+}
+
+// normalizeQuery collapses the spacing of a query for echoing back.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func HandleTranslations(c echo.Context, translations *similarity.Translations) error {
+	return c.JSON(http.StatusOK, translations.List())
+}
+
+func HandleCacheStats(c echo.Context, embedder *embeddings.CachedEmbedder) error {
+	return c.JSON(http.StatusOK, embedder.Stats())
 }
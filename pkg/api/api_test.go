@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/similarity"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer serves the search endpoints over a KJV of John 3, John 21 and
+// Psalm 23, whose vectors come from a FakeEmbedder.
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	embedder := embeddings.NewFakeEmbedder(8)
+	embed := func(text string) []float32 {
+		vector, err := embedder.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return embeddings.ToFloat32(vector)
+	}
+
+	var chapters, verses []Embedding
+	for _, c := range []struct {
+		book            string
+		chapter, verses int
+	}{{"Psalms", 23, 6}, {"John", 3, 36}, {"John", 21, 25}} {
+		var texts []string
+		for v := 1; v <= c.verses; v++ {
+			location := fmt.Sprintf("%s %d:%d", c.book, c.chapter, v)
+			text := "text of " + location
+			texts = append(texts, text)
+			verses = append(verses, Embedding{Location: location, Verse: text, Embedding: embed(text), Index: len(verses)})
+		}
+		location := fmt.Sprintf("%s %d", c.book, c.chapter)
+		text := strings.Join(texts, " ")
+		chapters = append(chapters, Embedding{Location: location, Verse: text, Embedding: embed(text), Index: len(chapters)})
+	}
+	translations := similarity.NewTranslations()
+	translations.Add("KJV", similarity.NewCorpus(chapters, verses))
+	translations.SetDefault("KJV")
+
+	e := echo.New()
+	e.HTTPErrorHandler = HandleError
+	e.GET("/search/verse", func(c echo.Context) error {
+		return HandleSearchByVerse(c, translations, embedder)
+	})
+	e.GET("/search/chapter", func(c echo.Context) error {
+		return HandleSearchByChapter(c, translations, embedder)
+	})
+	e.GET("/search/passage", func(c echo.Context) error {
+		return HandleSearchByPassage(c, translations, embedder)
+	})
+	return e
+}
+
+func TestStructuredSearchReferences(t *testing.T) {
+	e := newTestServer(t)
+	tests := []struct {
+		name      string
+		url       string
+		status    int
+		code      string
+		reference string
+	}{
+		{"verse", "/search/verse?book=John&chapter=3&verse=16", http.StatusOK, "", "John 3:16"},
+		{"verse by abbreviation", "/search/verse?book=jn&chapter=3&verse=16", http.StatusOK, "", "John 3:16"},
+		{"verse without a book", "/search/verse?chapter=3&verse=16", http.StatusBadRequest, "bad_request", ""},
+		{"verse in no book", "/search/verse?book=Hezekiah&chapter=3&verse=16", http.StatusBadRequest, "bad_request", ""},
+		{"verse number not a number", "/search/verse?book=John&chapter=3&verse=x", http.StatusBadRequest, "bad_request", ""},
+		{"verse zero", "/search/verse?book=John&chapter=3&verse=0", http.StatusBadRequest, "bad_request", ""},
+		{"chapter past the book", "/search/verse?book=John&chapter=22&verse=1", http.StatusNotFound, "reference_not_found", ""},
+		{"verse past the chapter", "/search/verse?book=John&chapter=3&verse=37", http.StatusNotFound, "reference_not_found", ""},
+		{"book not in the translation", "/search/verse?book=Genesis&chapter=1&verse=1", http.StatusNotFound, "reference_not_found", ""},
+
+		{"chapter", "/search/chapter?book=ps&chapter=23", http.StatusOK, "", "Psalms 23"},
+		{"chapter without a book", "/search/chapter?chapter=23", http.StatusBadRequest, "bad_request", ""},
+		{"chapter without a number", "/search/chapter?book=Psalms", http.StatusBadRequest, "bad_request", ""},
+		{"missing chapter", "/search/chapter?book=John&chapter=22", http.StatusNotFound, "reference_not_found", ""},
+
+		{"passage", "/search/passage?book=John&chapter=3&verseStart=16&verseEnd=18", http.StatusOK, "", "John 3:16-18"},
+		{"passage across chapters", "/search/passage?book=jhn&chapter=3&verseStart=35&chapterEnd=21&verseEnd=1", http.StatusOK, "", "John 3:35-21:1"},
+		{"passage without a book", "/search/passage?chapter=3&verseStart=16&verseEnd=18", http.StatusBadRequest, "bad_request", ""},
+		{"passage ending before it starts", "/search/passage?book=John&chapter=3&verseStart=18&verseEnd=16", http.StatusBadRequest, "bad_request", ""},
+		{"passage past the book", "/search/passage?book=John&chapter=22&verseStart=1&verseEnd=2", http.StatusNotFound, "reference_not_found", ""},
+		{"passage past the chapter", "/search/passage?book=John&chapter=3&verseStart=35&verseEnd=40", http.StatusNotFound, "reference_not_found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get("X-Reference"); got != tt.reference {
+				t.Errorf("X-Reference = %q, want %q", got, tt.reference)
+			}
+			if tt.code == "" {
+				return
+			}
+			var out ErrorOutput
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatalf("body %q: %v", rec.Body, err)
+			}
+			if out.Code != tt.code {
+				t.Errorf("code = %q, want %q", out.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/similarity"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorOutput is the body of every error response. Code is stable and meant
+// for programs; Message is for people.
+type ErrorOutput struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorStatuses maps the errors of the search packages to an HTTP status and
+// code, checked in order with errors.Is.
+var errorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{similarity.ErrInvalidReference, http.StatusBadRequest, "invalid_reference"},
+	{similarity.ErrReferenceNotFound, http.StatusNotFound, "reference_not_found"},
+	{similarity.ErrBeyondIndex, http.StatusBadRequest, "bad_request"},
+	{embeddings.ErrProviderUnavailable, http.StatusServiceUnavailable, "provider_unavailable"},
+	{embeddings.ErrProviderFailed, http.StatusBadGateway, "provider_error"},
+	{embeddings.ErrDimensionMismatch, http.StatusBadGateway, "dimension_mismatch"},
+	{similarity.ErrEmptyCorpus, http.StatusServiceUnavailable, "empty_corpus"},
+}
+
+// HandleError is the server's echo.HTTPErrorHandler. It writes every error,
+// whether raised by a handler or by echo itself, as an ErrorOutput.
+func HandleError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, out := errorResponse(err)
+	if status >= http.StatusInternalServerError {
+		fmt.Printf("Error serving %s: %s\n", c.Request().URL, err)
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, out)
+	}
+	if err != nil {
+		fmt.Printf("Error writing error response: %s\n", err)
+	}
+}
+
+func errorResponse(err error) (int, ErrorOutput) {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code, ErrorOutput{Code: statusCode(httpErr.Code), Message: fmt.Sprint(httpErr.Message)}
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status, ErrorOutput{Code: e.code, Message: err.Error()}
+		}
+	}
+	return http.StatusInternalServerError, ErrorOutput{Code: "internal_error", Message: http.StatusText(http.StatusInternalServerError)}
+}
+
+// statusCode names a status for ErrorOutput.Code: 400 is "bad_request".
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
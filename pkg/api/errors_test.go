@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/similarity"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandleError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"bad parameter", echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'limit' must be a positive integer"), http.StatusBadRequest, "bad_request"},
+		{"not found route", echo.ErrNotFound, http.StatusNotFound, "not_found"},
+		{"invalid reference", fmt.Errorf("%w %q", similarity.ErrInvalidReference, "Nowhere 3"), http.StatusBadRequest, "invalid_reference"},
+		{"reference not found", fmt.Errorf("%w: John 3 has only 36 verses", similarity.ErrReferenceNotFound), http.StatusNotFound, "reference_not_found"},
+		{"beyond index", fmt.Errorf("%w: offset 1000", similarity.ErrBeyondIndex), http.StatusBadRequest, "bad_request"},
+		{"provider failed", fmt.Errorf("%w: status 500", embeddings.ErrProviderFailed), http.StatusBadGateway, "provider_error"},
+		{"dimension mismatch", fmt.Errorf("%w: 3 and 4", embeddings.ErrDimensionMismatch), http.StatusBadGateway, "dimension_mismatch"},
+		{"provider unavailable", fmt.Errorf("%w: no provider configured", embeddings.ErrProviderUnavailable), http.StatusServiceUnavailable, "provider_unavailable"},
+		{"empty corpus", fmt.Errorf("%w: no chapter embeddings in WEB", similarity.ErrEmptyCorpus), http.StatusServiceUnavailable, "empty_corpus"},
+		{"anything else", errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/search", nil), rec)
+			HandleError(tt.err, c)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var out ErrorOutput
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatalf("body %q: %v", rec.Body.String(), err)
+			}
+			if out.Code != tt.code {
+				t.Errorf("code = %q, want %q", out.Code, tt.code)
+			}
+			if out.Message == "" {
+				t.Error("message is empty")
+			}
+		})
+	}
+}
+
+func TestHandleErrorHidesInternalErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/search", nil), rec)
+	HandleError(errors.New("open /secret/path: permission denied"), c)
+
+	var out ErrorOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Message != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("message = %q, want the status text", out.Message)
+	}
+}
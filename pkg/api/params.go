@@ -0,0 +1,293 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"go-scripture/pkg/reference"
+	"go-scripture/pkg/similarity"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxLimit = 500
+
+// parseSearchOptions reads the paging parameters shared by every /search route:
+//
+//	limit           results per page (default 50, at most 500)
+//	offset          results to skip (default 0)
+//	min_score       drop results scoring below this (default -1, no cut-off)
+//	index           "exact" forces a brute-force search instead of the ANN index
+//	reference_mode  auto, force or off (default referenceMode)
+//	mode            semantic (default) or hybrid, which fuses in keyword ranking
+//	fusion          rrf (default) or weighted, for hybrid mode
+//	alpha           weight of the semantic ranking in hybrid mode, 0 to 1 (default 0.5)
+//	books           comma-separated books, or ranges of books such as Matthew-John
+//	testament       OT or NT
+//	from, to        references bounding the canonical range searched
+//	exclude         comma-separated references never returned
+func parseSearchOptions(c echo.Context, referenceMode similarity.ReferenceMode) (similarity.SearchOptions, error) {
+	opts := similarity.DefaultSearchOptions()
+	opts.UseIndex = c.QueryParam("index") != "exact"
+
+	opts.ReferenceMode = referenceMode
+	switch mode := similarity.ReferenceMode(c.QueryParam("reference_mode")); mode {
+	case "":
+	case similarity.ReferenceAuto, similarity.ReferenceForce, similarity.ReferenceOff:
+		opts.ReferenceMode = mode
+	default:
+		return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'reference_mode' must be one of auto, force or off")
+	}
+
+	switch mode := similarity.SearchMode(c.QueryParam("mode")); mode {
+	case "":
+	case similarity.ModeSemantic, similarity.ModeHybrid:
+		opts.Mode = mode
+	default:
+		return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'mode' must be semantic or hybrid")
+	}
+	switch fusion := similarity.FusionMethod(c.QueryParam("fusion")); fusion {
+	case "":
+	case similarity.FusionRRF, similarity.FusionWeighted:
+		opts.Fusion = fusion
+	default:
+		return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'fusion' must be rrf or weighted")
+	}
+	if s := c.QueryParam("alpha"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f > 1 {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'alpha' must be a number between 0 and 1")
+		}
+		opts.Alpha = f
+	}
+
+	if s := c.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLimit {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter 'limit' must be an integer between 1 and %d", maxLimit))
+		}
+		opts.Limit = n
+	}
+	if s := c.QueryParam("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'offset' must be a non-negative integer")
+		}
+		opts.Offset = n
+	}
+	if s := c.QueryParam("min_score"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'min_score' must be a number")
+		}
+		opts.MinScore = f
+	}
+
+	scopes := []struct {
+		param string
+		set   func(*similarity.Filter, string) error
+	}{
+		{"books", (*similarity.Filter).SetBooks},
+		{"testament", (*similarity.Filter).SetTestament},
+		{"from", (*similarity.Filter).SetFrom},
+		{"to", (*similarity.Filter).SetTo},
+		{"exclude", (*similarity.Filter).SetExcluded},
+	}
+	for _, scope := range scopes {
+		if s := c.QueryParam(scope.param); s != "" {
+			if err := scope.set(&opts.Filter, s); err != nil {
+				return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter '%s' is invalid: %s", scope.param, err))
+			}
+		}
+	}
+	return opts, nil
+}
+
+const maxPassageLen = 50
+
+// parsePassageOptions reads the parameters shaping passage results:
+//
+//	min_len        fewest verses in a passage (default 1)
+//	max_len        most verses in a passage (default 12, at most 50)
+//	gap_tolerance  consecutive weak verses a passage may bridge (default 1)
+func parsePassageOptions(c echo.Context) (similarity.PassageOptions, error) {
+	opts := similarity.DefaultPassageOptions()
+	if s := c.QueryParam("min_len"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPassageLen {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter 'min_len' must be an integer between 1 and %d", maxPassageLen))
+		}
+		opts.MinLen = n
+	}
+	if s := c.QueryParam("max_len"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPassageLen {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter 'max_len' must be an integer between 1 and %d", maxPassageLen))
+		}
+		opts.MaxLen = n
+	}
+	if opts.MinLen > opts.MaxLen {
+		return opts, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'min_len' must not exceed 'max_len'")
+	}
+	if s := c.QueryParam("gap_tolerance"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxPassageLen {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter 'gap_tolerance' must be an integer between 0 and %d", maxPassageLen))
+		}
+		opts.GapTolerance = n
+	}
+	return opts, nil
+}
+
+// parseDiversity reads the parameters spreading out the results of /search and
+// /search/all:
+//
+//	diversify        mmr re-ranks by maximal marginal relevance
+//	lambda           weight of relevance against redundancy for mmr, 0 to 1 (default 0.7)
+//	max_per_book     most results from one book
+//	max_per_chapter  most results from one chapter
+func parseDiversity(c echo.Context) (similarity.Diversity, error) {
+	d := similarity.Diversity{Lambda: similarity.DefaultLambda}
+	switch c.QueryParam("diversify") {
+	case "":
+	case "mmr":
+		d.MMR = true
+	default:
+		return d, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'diversify' must be mmr")
+	}
+	if s := c.QueryParam("lambda"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f > 1 {
+			return d, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'lambda' must be a number between 0 and 1")
+		}
+		d.Lambda = f
+	}
+	for _, limit := range []struct {
+		param string
+		value *int
+	}{
+		{"max_per_book", &d.MaxPerBook},
+		{"max_per_chapter", &d.MaxPerChapter},
+	} {
+		if s := c.QueryParam(limit.param); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return d, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter '%s' must be a positive integer", limit.param))
+			}
+			*limit.value = n
+		}
+	}
+	return d, nil
+}
+
+// corpusFor returns the corpus of the translation named by the 'translation'
+// query parameter, or of the default translation.
+func corpusFor(c echo.Context, translations *similarity.Translations) (*similarity.Corpus, error) {
+	id := c.QueryParam("translation")
+	corpus, ok := translations.Get(id)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown translation '%s'; loaded translations are %s", id, strings.Join(translations.IDs(), ", ")))
+	}
+	return corpus, nil
+}
+
+// parallelCorpora returns the corpora of the translations listed in the
+// 'translations' query parameter, e.g. "KJV,WEB,ASV".
+func parallelCorpora(c echo.Context, translations *similarity.Translations) ([]*similarity.Corpus, error) {
+	var corpora []*similarity.Corpus
+	for _, id := range strings.Split(c.QueryParam("translations"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		corpus, ok := translations.Get(id)
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown translation '%s' in 'translations'; loaded translations are %s", id, strings.Join(translations.IDs(), ", ")))
+		}
+		corpora = append(corpora, corpus)
+	}
+	return corpora, nil
+}
+
+// passageVerseScores scores every verse with no cut-off, which passage detection
+// needs regardless of the page requested.
+func passageVerseScores(opts similarity.SearchOptions) similarity.SearchOptions {
+	return similarity.SearchOptions{MinScore: -1, ReferenceMode: opts.ReferenceMode, Filter: opts.Filter}
+}
+
+// headOf asks for every result down to the end of opts' page, or as deep as
+// opts.Diversity re-ranks, with no cut-off: /search/all merges these and then
+// applies the cut-off, diversity and paging itself.
+func headOf(opts similarity.SearchOptions) similarity.SearchOptions {
+	head := opts
+	head.Limit, head.Offset = similarity.RankingDepth(opts), 0
+	head.MinScore = math.Inf(-1)
+	head.Diversity = similarity.Diversity{}
+	return head
+}
+
+// everyResult asks for every result of opts' ranking, with no cut-off or
+// paging.
+func everyResult(opts similarity.SearchOptions) similarity.SearchOptions {
+	every := headOf(opts)
+	every.Limit = 0
+	return every
+}
+
+// parseQuery takes the filters written into a query ("grace book:Romans", see
+// similarity.Query) into opts.Filter and returns the text left to search for.
+func parseQuery(query string, opts *similarity.SearchOptions) (string, error) {
+	q, err := similarity.ParseQuery(query)
+	var queryErr *similarity.QueryError
+	if errors.As(err, &queryErr) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid query token '%s': %s", queryErr.Token, queryErr.Msg))
+	}
+	if err != nil {
+		return "", err
+	}
+	if q.Text == "" && !q.Filter.IsEmpty() {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'query' has filters but nothing to search for")
+	}
+	opts.Filter = opts.Filter.And(q.Filter)
+	return q.Text, nil
+}
+
+// bookParam reads the 'book' query parameter, a book name or abbreviation.
+func bookParam(c echo.Context) (reference.Book, error) {
+	name := c.QueryParam("book")
+	if name == "" {
+		return reference.Book{}, echo.NewHTTPError(http.StatusBadRequest, "Missing query parameter 'book'")
+	}
+	book, ok := reference.LookupBook(name)
+	if !ok {
+		return reference.Book{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter 'book' must name a book of the Bible, not '%s'", name))
+	}
+	return book, nil
+}
+
+// positiveIntParam reads a required chapter or verse number.
+func positiveIntParam(c echo.Context, name string) (int, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing query parameter '%s'", name))
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter '%s' must be a positive integer", name))
+	}
+	return n, nil
+}
+
+// checkReference reports a reference to chapters or verses the corpus does not
+// have as similarity.ErrReferenceNotFound, and otherwise sends its canonical
+// form back in the X-Reference header.
+func checkReference(c echo.Context, corpus *similarity.Corpus, ref reference.Reference) error {
+	if err := corpus.Versification.Validate(ref); err != nil {
+		return fmt.Errorf("%w: %w", similarity.ErrReferenceNotFound, err)
+	}
+	c.Response().Header().Set("X-Reference", ref.String())
+	return nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"go-scripture/pkg/reference"
+	"go-scripture/pkg/similarity"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Response versions, chosen with the 'v' query parameter. Version 1 is the
+// original bare array of SearchOutput; version 2, the default, is a
+// SearchResponse envelope.
+const (
+	responseV1      = 1
+	responseV2      = 2
+	responseDefault = responseV2
+)
+
+// SearchOutput is one result in a version 1 response.
+type SearchOutput struct {
+	Index        int                                   `json:"index"`
+	Location     string                                `json:"location"`
+	Verse        string                                `json:"verse"`
+	Similarities float64                               `json:"similarities"`
+	Translations map[string][]similarity.ParallelVerse `json:"translations,omitempty"`
+	// Match is the span of Verse a quote search matched.
+	Match *similarity.Span `json:"match,omitempty"`
+}
+
+// SearchResponse is the version 2 response of every /search route.
+type SearchResponse struct {
+	Version int `json:"version"`
+	// Query is the text searched, with filters removed and spaces collapsed,
+	// or the canonical reference for /search/verse, /search/chapter and
+	// /search/passage.
+	Query string `json:"query"`
+	// Reference is the reference detected in the query and searched from, if
+	// any.
+	Reference   string `json:"reference,omitempty"`
+	Mode        string `json:"mode"`
+	Model       string `json:"model,omitempty"`
+	Translation string `json:"translation"`
+	TookMs      int64  `json:"took_ms"`
+	Total       int    `json:"total"`
+	// TotalApproximate is set when Total counts only the results the ANN
+	// index ranked, rather than every match.
+	TotalApproximate bool         `json:"total_approximate,omitempty"`
+	Offset           int          `json:"offset"`
+	Items            []SearchItem `json:"items"`
+}
+
+// SearchItem is one result in a version 2 response. Type is "verse",
+// "chapter" or "passage"; VerseStart and VerseEnd are omitted for a chapter,
+// and ChapterEnd unless a passage runs into a later chapter.
+type SearchItem struct {
+	Index        int                                   `json:"index"`
+	Type         string                                `json:"type"`
+	Location     string                                `json:"location"`
+	Book         string                                `json:"book,omitempty"`
+	Chapter      int                                   `json:"chapter,omitempty"`
+	ChapterEnd   int                                   `json:"chapter_end,omitempty"`
+	VerseStart   int                                   `json:"verse_start,omitempty"`
+	VerseEnd     int                                   `json:"verse_end,omitempty"`
+	OSIS         string                                `json:"osis,omitempty"`
+	Text         string                                `json:"text"`
+	Score        float64                               `json:"score"`
+	Match        *similarity.Span                      `json:"match,omitempty"`
+	Translations map[string][]similarity.ParallelVerse `json:"translations,omitempty"`
+	// Absorbed lists, for /search/all, the results covering the same text
+	// that this one stands for.
+	Absorbed []string `json:"absorbed,omitempty"`
+}
+
+// searchMeta is what a version 2 response reports about a search besides its
+// results. Handlers start it when the request arrives.
+type searchMeta struct {
+	start     time.Time
+	query     string
+	reference string
+	mode      string
+	model     string
+	// approximate is set when total only counts the candidates of an ANN
+	// search.
+	approximate bool
+}
+
+func startSearch() searchMeta {
+	return searchMeta{start: time.Now()}
+}
+
+// responseVersion reads the 'v' query parameter.
+func responseVersion(c echo.Context) (int, error) {
+	switch c.QueryParam("v") {
+	case "":
+		return responseDefault, nil
+	case "1":
+		return responseV1, nil
+	case "2":
+		return responseV2, nil
+	}
+	return 0, echo.NewHTTPError(http.StatusBadRequest, "Query parameter 'v' must be 1 or 2")
+}
+
+// respondWithResults writes one page of results, with each result's verses in
+// the parallel translations when any were asked for. The number of results
+// across all pages is also sent in the X-Total-Count header, which is all a
+// version 1 client gets besides the plain array.
+func respondWithResults(c echo.Context, meta searchMeta, corpus *similarity.Corpus, parallel []*similarity.Corpus, found []Embedding, total int, offset int) error {
+	return respondWithItems(c, meta, corpus, parallel, found, nil, total, offset)
+}
+
+// respondWithQuotes writes one page of quote matches like respondWithResults,
+// with the matched span of each.
+func respondWithQuotes(c echo.Context, meta searchMeta, corpus *similarity.Corpus, parallel []*similarity.Corpus, quotes []similarity.QuoteMatch, total int, offset int) error {
+	found := make([]Embedding, len(quotes))
+	notes := make([]itemNote, len(quotes))
+	for i := range quotes {
+		found[i] = quotes[i].Embedding
+		notes[i].match = &quotes[i].Span
+	}
+	return respondWithItems(c, meta, corpus, parallel, found, notes, total, offset)
+}
+
+// respondWithMerged writes one page of merged /search/all results like
+// respondWithResults, with what each absorbed.
+func respondWithMerged(c echo.Context, meta searchMeta, corpus *similarity.Corpus, parallel []*similarity.Corpus, merged []similarity.MergedResult, total int, offset int) error {
+	found := make([]Embedding, len(merged))
+	notes := make([]itemNote, len(merged))
+	for i := range merged {
+		found[i] = merged[i].Embedding
+		notes[i].absorbed = merged[i].Absorbed
+	}
+	return respondWithItems(c, meta, corpus, parallel, found, notes, total, offset)
+}
+
+// itemNote is what some searches add to a result.
+type itemNote struct {
+	match    *similarity.Span
+	absorbed []string
+}
+
+func respondWithItems(c echo.Context, meta searchMeta, corpus *similarity.Corpus, parallel []*similarity.Corpus, found []Embedding, notes []itemNote, total int, offset int) error {
+	version, err := responseVersion(c)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(total))
+	if meta.approximate {
+		c.Response().Header().Set("X-Total-Approximate", "true")
+	}
+
+	if version == responseV1 {
+		searchResults := make([]SearchOutput, 0, len(found))
+		for i, e := range found {
+			out := SearchOutput{
+				Index:        offset + i,
+				Location:     e.Location,
+				Verse:        e.Verse,
+				Similarities: e.Similarity,
+			}
+			if notes != nil {
+				out.Match = notes[i].match
+			}
+			if len(parallel) > 0 {
+				out.Translations = corpus.ParallelText(e.Location, parallel)
+			}
+			searchResults = append(searchResults, out)
+		}
+		return c.JSON(http.StatusOK, searchResults)
+	}
+
+	items := make([]SearchItem, 0, len(found))
+	for i, e := range found {
+		item := searchItem(e)
+		item.Index = offset + i
+		if notes != nil {
+			item.Match, item.Absorbed = notes[i].match, notes[i].absorbed
+		}
+		if len(parallel) > 0 {
+			item.Translations = corpus.ParallelText(e.Location, parallel)
+		}
+		items = append(items, item)
+	}
+	return c.JSON(http.StatusOK, SearchResponse{
+		Version:          responseV2,
+		Query:            meta.query,
+		Reference:        meta.reference,
+		Mode:             meta.mode,
+		Model:            meta.model,
+		Translation:      corpus.Translation,
+		TookMs:           time.Since(meta.start).Milliseconds(),
+		Total:            total,
+		TotalApproximate: meta.approximate,
+		Offset:           offset,
+		Items:            items,
+	})
+}
+
+// searchItem describes a result by its location: a whole chapter, a single
+// verse, or a passage of several verses.
+func searchItem(e Embedding) SearchItem {
+	item := SearchItem{Type: "verse", Location: e.Location, Text: e.Verse, Score: e.Similarity}
+	refs, err := reference.Parse(e.Location)
+	if err != nil || len(refs) != 1 || len(refs[0].Ranges) != 1 {
+		return item
+	}
+	ref, rg := refs[0], refs[0].Ranges[0]
+	item.Book = ref.Book.Name
+	item.Chapter = rg.StartChapter
+	item.OSIS = ref.OSIS()
+	if rg.IsWholeChapters() {
+		item.Type = "chapter"
+	} else {
+		item.VerseStart, item.VerseEnd = rg.StartVerse, rg.EndVerse
+		if !rg.IsSingleVerse() {
+			item.Type = "passage"
+		}
+	}
+	if rg.CrossesChapters() {
+		item.ChapterEnd = rg.EndChapter
+	}
+	return item
+}
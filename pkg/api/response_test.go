@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestResponseVersions(t *testing.T) {
+	e := newTestServer(t)
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		return rec
+	}
+
+	t.Run("v1 array", func(t *testing.T) {
+		rec := get(t, "/search/verse?book=John&chapter=3&verse=16&limit=3&v=1")
+
+		var raw []map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("body %q is not an array: %v", rec.Body, err)
+		}
+		if len(raw) != 3 {
+			t.Fatalf("got %d results, want 3", len(raw))
+		}
+		for _, key := range []string{"index", "location", "verse", "similarities"} {
+			if _, ok := raw[0][key]; !ok {
+				t.Errorf("result has no %q: %s", key, rec.Body)
+			}
+		}
+		for _, key := range []string{"type", "score", "osis"} {
+			if _, ok := raw[0][key]; ok {
+				t.Errorf("v1 result has %q: %s", key, rec.Body)
+			}
+		}
+
+		var out []SearchOutput
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out[0].Index != 0 || out[0].Location != "John 3:16" || out[0].Verse != "text of John 3:16" {
+			t.Errorf("first result = %+v, want John 3:16 at index 0", out[0])
+		}
+		if got := rec.Header().Get("X-Total-Count"); got == "" {
+			t.Error("no X-Total-Count")
+		}
+	})
+
+	t.Run("v2 envelope", func(t *testing.T) {
+		rec := get(t, "/search/verse?book=John&chapter=3&verse=16&limit=3&offset=1")
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("body %q is not an object: %v", rec.Body, err)
+		}
+		for _, key := range []string{"version", "query", "reference", "mode", "translation", "took_ms", "total", "offset", "items"} {
+			if _, ok := raw[key]; !ok {
+				t.Errorf("response has no %q: %s", key, rec.Body)
+			}
+		}
+
+		var out SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Version != 2 || out.Query != "John 3:16" || out.Reference != "John 3:16" || out.Translation != "KJV" || out.Offset != 1 {
+			t.Errorf("envelope = %+v", out)
+		}
+		if total := rec.Header().Get("X-Total-Count"); total != strconv.Itoa(out.Total) || out.Total == 0 {
+			t.Errorf("total = %d, X-Total-Count = %s", out.Total, total)
+		}
+		if len(out.Items) != 3 {
+			t.Fatalf("got %d items, want 3", len(out.Items))
+		}
+		for i, item := range out.Items {
+			if item.Index != 1+i {
+				t.Errorf("item %d index = %d, want %d", i, item.Index, 1+i)
+			}
+			if item.Type != "verse" || item.Book == "" || item.VerseStart == 0 || item.VerseStart != item.VerseEnd || item.OSIS == "" {
+				t.Errorf("item %d = %+v, want a verse", i, item)
+			}
+		}
+	})
+
+	t.Run("bad version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/verse?book=John&chapter=3&verse=16&v=3", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestSearchItem(t *testing.T) {
+	tests := []struct {
+		location string
+		want     SearchItem
+	}{
+		{"John 3:16", SearchItem{Type: "verse", Location: "John 3:16", Book: "John", Chapter: 3, VerseStart: 16, VerseEnd: 16, OSIS: "John.3.16"}},
+		{"Psalms 23", SearchItem{Type: "chapter", Location: "Psalms 23", Book: "Psalms", Chapter: 23, OSIS: "Ps.23"}},
+		{"John 3:16-18", SearchItem{Type: "passage", Location: "John 3:16-18", Book: "John", Chapter: 3, VerseStart: 16, VerseEnd: 18, OSIS: "John.3.16-John.3.18"}},
+		{"John 3:35-4:2", SearchItem{Type: "passage", Location: "John 3:35-4:2", Book: "John", Chapter: 3, ChapterEnd: 4, VerseStart: 35, VerseEnd: 2, OSIS: "John.3.35-John.4.2"}},
+		{"not a reference", SearchItem{Type: "verse", Location: "not a reference"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			got := searchItem(Embedding{Location: tt.location})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
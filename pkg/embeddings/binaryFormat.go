@@ -0,0 +1,279 @@
+package embeddings
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// Binary embedding dataset layout, all integers little-endian:
+//
+//	magic      [4]byte "GSEB"
+//	version    uint16
+//	modelLen   uint16, followed by modelLen bytes of model name
+//	dimension  uint32
+//	rows       uint32
+//	checksum   uint32  CRC-32 (IEEE) of the whole file but these four bytes
+//	padding    zero bytes up to a multiple of 4, aligning the vectors
+//	vectors    rows*dimension float32
+//	text table rows * (index uint32, locLen uint16, location, verseLen uint32, verse)
+const (
+	binaryMagic   = "GSEB"
+	binaryVersion = 1
+)
+
+// BinaryHeader describes a binary embedding dataset.
+type BinaryHeader struct {
+	Model     string
+	Dimension int
+	Rows      int
+	Checksum  uint32
+}
+
+// maxHeaderLen is the length of a header with the longest model name.
+const maxHeaderLen = 4 + 2 + 2 + math.MaxUint16 + 4 + 4 + 4
+
+// WriteBinary writes embeddings in the binary dataset format.
+func WriteBinary(w io.Writer, model string, embeddings []Embedding) error {
+	if len(embeddings) == 0 {
+		return errors.New("no embeddings to write")
+	}
+	if len(model) > math.MaxUint16 {
+		return errors.New("model name too long")
+	}
+	dimension := len(embeddings[0].Embedding)
+	if dimension == 0 {
+		return errors.New("embeddings have no dimensions")
+	}
+
+	var buf []byte
+	buf = append(buf, binaryMagic...)
+	buf = binary.LittleEndian.AppendUint16(buf, binaryVersion)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(model)))
+	buf = append(buf, model...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(dimension))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(embeddings)))
+	buf = binary.LittleEndian.AppendUint32(buf, 0) // checksum, filled in last
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+
+	for i, e := range embeddings {
+		if len(e.Embedding) != dimension {
+			return fmt.Errorf("row %d (%s) has dimension %d, expected %d", i, e.Location, len(e.Embedding), dimension)
+		}
+		for _, f := range e.Embedding {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+	}
+	for _, e := range embeddings {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(e.Index))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(e.Location)))
+		buf = append(buf, e.Location...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.Verse)))
+		buf = append(buf, e.Verse...)
+	}
+	checksumAt := checksumOffset(model)
+	binary.LittleEndian.PutUint32(buf[checksumAt:], datasetChecksum(buf, checksumAt))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// checksumOffset is where the checksum is in a dataset made with model.
+func checksumOffset(model string) int {
+	return 4 + 2 + 2 + len(model) + 4 + 4
+}
+
+// datasetChecksum is the CRC-32 of data but the checksum stored at checksumAt.
+func datasetChecksum(data []byte, checksumAt int) uint32 {
+	crc := crc32.ChecksumIEEE(data[:checksumAt])
+	return crc32.Update(crc, crc32.IEEETable, data[checksumAt+4:])
+}
+
+// decodeHeader parses the header at the start of r, leaving r at the vectors.
+func decodeHeader(r *binaryReader) (BinaryHeader, error) {
+	var header BinaryHeader
+	if string(r.bytes(4)) != binaryMagic {
+		return header, errors.New("not a binary embedding dataset")
+	}
+	if v := r.uint16(); v != binaryVersion {
+		return header, fmt.Errorf("unsupported dataset version %d", v)
+	}
+	header.Model = string(r.bytes(int(r.uint16())))
+	dimension, rows := r.uint32(), r.uint32()
+	header.Checksum = r.uint32()
+	r.bytes((4 - r.off%4) % 4)
+	if r.err != nil {
+		return header, r.err
+	}
+
+	// Check the sizes against what is left before allocating anything for
+	// them, dividing so that nothing overflows.
+	if dimension == 0 {
+		return header, errors.New("dimension is 0")
+	}
+	if uint64(rows) > uint64(len(r.data)-r.off)/4/uint64(dimension) {
+		return header, fmt.Errorf("%d rows of %d dimensions do not fit in %d bytes", rows, dimension, len(r.data))
+	}
+	header.Dimension, header.Rows = int(dimension), int(rows)
+	return header, nil
+}
+
+// decodeBinary parses a complete binary dataset held in data. The vectors are
+// float32 views of data itself, unless this platform cannot read them in place.
+func decodeBinary(data []byte) (BinaryHeader, []Embedding, error) {
+	r := binaryReader{data: data}
+	header, err := decodeHeader(&r)
+	if err != nil {
+		return header, nil, err
+	}
+	if datasetChecksum(data, checksumOffset(header.Model)) != header.Checksum {
+		return header, nil, errors.New("checksum mismatch")
+	}
+
+	vectors := float32s(r.bytes(4 * header.Rows * header.Dimension))
+	embeddings := make([]Embedding, header.Rows)
+	for i := range embeddings {
+		start, end := i*header.Dimension, (i+1)*header.Dimension
+		embeddings[i].Embedding = vectors[start:end:end]
+	}
+	for i := range embeddings {
+		embeddings[i].Index = int(r.uint32())
+		embeddings[i].Location = string(r.bytes(int(r.uint16())))
+		embeddings[i].Verse = string(r.bytes(int(r.uint32())))
+	}
+	if r.err != nil {
+		return header, nil, r.err
+	}
+	return header, embeddings, nil
+}
+
+// float32s reads little-endian float32s. When this platform is little-endian
+// and b is aligned, as a mapping always is, the result shares b's memory;
+// otherwise it is a copy.
+func float32s(b []byte) []float32 {
+	if len(b) == 0 {
+		return nil
+	}
+	if littleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), len(b)/4)
+	}
+	out := make([]float32, len(b)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return out
+}
+
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// binaryReader walks a byte slice, remembering the first out-of-bounds read.
+type binaryReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.data)-r.off {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *binaryReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// DatasetModel returns the model named in the header of the binary dataset
+// loaded for csvFile, or false when there is none, as for a CSV.
+func DatasetModel(csvFile string) (string, bool) {
+	file := csvFile
+	if !strings.HasSuffix(file, ".bin") {
+		file = BinaryPath(csvFile)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxHeaderLen))
+	if err != nil {
+		return "", false
+	}
+	r := binaryReader{data: data}
+	if string(r.bytes(4)) != binaryMagic || r.uint16() != binaryVersion {
+		return "", false
+	}
+	model := r.bytes(int(r.uint16()))
+	if r.err != nil {
+		return "", false
+	}
+	return string(model), true
+}
+
+// loadEmbeddingsFromBinary memory-maps a binary dataset. The vectors stay in
+// the read-only mapping, which is never unmapped: the embeddings it backs live
+// as long as the process. Errors, including a bad header or checksum, wrap
+// ErrInvalidDataset.
+func loadEmbeddingsFromBinary(file string) ([]Embedding, error) {
+	data, unmap, err := mapFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDataset, err)
+	}
+
+	header, embeddings, err := decodeBinary(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%w: loading %s: %w", ErrInvalidDataset, file, err)
+	}
+	fmt.Printf("Loaded %d %d-dimensional %s embeddings from %s\n", header.Rows, header.Dimension, header.Model, file)
+	return embeddings, nil
+}
+
+// ConvertCSVToBinary reads a chapter or verse embeddings CSV (db is "chapter" or
+// "verse") and writes it to out in the binary dataset format.
+func ConvertCSVToBinary(csvFile string, db string, out string, model string) (int, error) {
+	embeddings, err := loadEmbeddingsFromFile(csvFile, db)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	if err := WriteBinary(f, model, embeddings); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(embeddings), f.Close()
+}
@@ -0,0 +1,152 @@
+package embeddings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testDataset() []Embedding {
+	return []Embedding{
+		{Index: 0, Location: "Genesis 1:1", Verse: "In the beginning God created the heaven and the earth.", Embedding: []float32{0.5, -1, 0, 2}},
+		{Index: 1, Location: "Genesis 1:2", Verse: "And the earth was without form, and void;", Embedding: []float32{1e-7, 3.25, -0.125, 1}},
+		{Index: 2, Location: "John 3:16", Verse: "", Embedding: []float32{math.MaxFloat32, -math.MaxFloat32, 1, -1}},
+	}
+}
+
+func writeTestDataset(t *testing.T, model string, embeddings []Embedding) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, model, embeddings); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withHeader overwrites the dimension and row count of a dataset written with
+// model and re-signs it, so that only header validation can reject it.
+func withHeader(data []byte, model string, dimension, rows uint32) []byte {
+	data = append([]byte(nil), data...)
+	at := checksumOffset(model)
+	binary.LittleEndian.PutUint32(data[at-8:], dimension)
+	binary.LittleEndian.PutUint32(data[at-4:], rows)
+	binary.LittleEndian.PutUint32(data[at:], datasetChecksum(data, at))
+	return data
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	want := testDataset()
+	// Model names of every length modulo 4 exercise the padding.
+	for _, model := range []string{"", "a", "ab", "text-embedding-3-small"} {
+		data := writeTestDataset(t, model, want)
+		header, got, err := decodeBinary(data)
+		if err != nil {
+			t.Fatalf("model %q: %v", model, err)
+		}
+		if header.Model != model || header.Dimension != 4 || header.Rows != len(want) {
+			t.Errorf("model %q: header = %+v", model, header)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("model %q: decoded %+v, want %+v", model, got, want)
+		}
+
+		// A misaligned copy is read through the copying path.
+		misaligned := make([]byte, len(data)+1)[1:]
+		copy(misaligned, data)
+		if _, got, err := decodeBinary(misaligned); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("model %q: misaligned decode = %+v, %v", model, got, err)
+		}
+	}
+}
+
+func TestWriteBinaryRejects(t *testing.T) {
+	for name, embeddings := range map[string][]Embedding{
+		"empty":         nil,
+		"no dimensions": {{Location: "Genesis 1:1"}},
+		"ragged":        {{Embedding: []float32{1, 2}}, {Embedding: []float32{1}}},
+	} {
+		if err := WriteBinary(&bytes.Buffer{}, "model", embeddings); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestDecodeBinaryTruncated(t *testing.T) {
+	data := writeTestDataset(t, "model", testDataset())
+	for _, n := range []int{0, 3, 4, 10, checksumOffset("model") + 2, checksumOffset("model") + 8, len(data) / 2, len(data) - 1} {
+		if _, _, err := decodeBinary(data[:n]); err == nil {
+			t.Errorf("decoded %d of %d bytes without error", n, len(data))
+		}
+	}
+}
+
+func TestDecodeBinaryCorruptHeader(t *testing.T) {
+	data := writeTestDataset(t, "model", testDataset())
+	flipped := func(i int) []byte {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0xff
+		return corrupt
+	}
+	tests := map[string][]byte{
+		"bad magic":          flipped(0),
+		"bad version":        flipped(4),
+		"model byte flipped": flipped(8),
+		"zero dimension":     withHeader(data, "model", 0, math.MaxUint32),
+		"rows overflow":      withHeader(data, "model", math.MaxUint32, math.MaxUint32),
+		"too many rows":      withHeader(data, "model", 4, 1<<30),
+		"trailing byte":      append(append([]byte(nil), data...), 0),
+	}
+	for name, corrupt := range tests {
+		if _, _, err := decodeBinary(corrupt); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestLoadEmbeddingsFromBinary(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "verses.csv")
+	want := testDataset()
+	if err := os.WriteFile(BinaryPath(csvFile), writeTestDataset(t, "model-a", want), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadEmbeddingsFromBinary(BinaryPath(csvFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+	if model, ok := DatasetModel(csvFile); !ok || model != "model-a" {
+		t.Errorf("DatasetModel = %q, %v, want model-a", model, ok)
+	}
+	if _, ok := DatasetModel(filepath.Join(dir, "missing.csv")); ok {
+		t.Error("DatasetModel found a model for a missing dataset")
+	}
+}
+
+func TestLoadEmbeddingsFromBinaryErrors(t *testing.T) {
+	dir := t.TempDir()
+	data := writeTestDataset(t, "model", testDataset())
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	notDataset := append([]byte("NOPE"), data[4:]...)
+
+	files := map[string][]byte{"checksum.bin": corrupt, "magic.bin": notDataset}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"checksum.bin", "magic.bin", "missing.bin"} {
+		if _, err := loadEmbeddingsFromBinary(filepath.Join(dir, name)); !errors.Is(err, ErrInvalidDataset) {
+			t.Errorf("%s: error = %v, want ErrInvalidDataset", name, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package embeddings
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CachedEmbedder wraps another Embedder with a bounded in-memory LRU in front of
+// an optional on-disk store. Entries are keyed by model name plus normalized text,
+// so switching models never serves stale vectors.
+type CachedEmbedder struct {
+	next  Embedder
+	store *DiskStore
+
+	mu  sync.Mutex
+	lru *lruCache
+
+	memoryHits atomic.Uint64
+	diskHits   atomic.Uint64
+	misses     atomic.Uint64
+}
+
+// CacheStats is a snapshot of the cache counters.
+type CacheStats struct {
+	Model         string `json:"model"`
+	MemoryHits    uint64 `json:"memory_hits"`
+	DiskHits      uint64 `json:"disk_hits"`
+	Misses        uint64 `json:"misses"`
+	MemoryEntries int    `json:"memory_entries"`
+	DiskEntries   int    `json:"disk_entries"`
+}
+
+const defaultEmbeddingCacheSize = 1000
+
+// NewCachedEmbedder caches up to capacity vectors in memory. store may be nil to
+// keep the cache in memory only.
+func NewCachedEmbedder(next Embedder, capacity int, store *DiskStore) *CachedEmbedder {
+	return &CachedEmbedder{
+		next:  next,
+		store: store,
+		lru:   newLRUCache(capacity),
+	}
+}
+
+// NewCachedEmbedderFromEnv wraps next using EMBEDDING_CACHE_SIZE (default 1000)
+// and EMBEDDING_CACHE_PATH (no disk store when unset).
+func NewCachedEmbedderFromEnv(next Embedder) (*CachedEmbedder, error) {
+	capacity := defaultEmbeddingCacheSize
+	if s := os.Getenv("EMBEDDING_CACHE_SIZE"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid EMBEDDING_CACHE_SIZE %q", s)
+		}
+		capacity = n
+	}
+
+	var store *DiskStore
+	if path := os.Getenv("EMBEDDING_CACHE_PATH"); path != "" {
+		var err error
+		store, err = OpenDiskStore(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewCachedEmbedder(next, capacity, store), nil
+}
+
+// normalizeQuery folds case and whitespace so trivially different spellings of
+// the same query share a cache entry.
+func normalizeQuery(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+func (c *CachedEmbedder) cacheKey(text string) string {
+	return c.next.Model() + "\x00" + normalizeQuery(text)
+}
+
+func (c *CachedEmbedder) lookup(key string) ([]float64, bool) {
+	c.mu.Lock()
+	vector, ok := c.lru.get(key)
+	c.mu.Unlock()
+	if ok {
+		c.memoryHits.Add(1)
+		return vector, true
+	}
+
+	if c.store != nil {
+		if vector, ok := c.store.Get(key); ok {
+			c.diskHits.Add(1)
+			c.mu.Lock()
+			c.lru.put(key, vector)
+			c.mu.Unlock()
+			return vector, true
+		}
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+func (c *CachedEmbedder) remember(key string, vector []float64) {
+	c.mu.Lock()
+	c.lru.put(key, vector)
+	c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.Put(key, vector); err != nil {
+			fmt.Printf("Error writing embedding cache: %s\n", err)
+		}
+	}
+}
+
+func (c *CachedEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	key := c.cacheKey(text)
+	if vector, ok := c.lookup(key); ok {
+		return vector, nil
+	}
+
+	vector, err := c.next.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.remember(key, vector)
+	return vector, nil
+}
+
+func (c *CachedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	var missing []int
+	for i, t := range texts {
+		if vector, ok := c.lookup(c.cacheKey(t)); ok {
+			vectors[i] = vector
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	toEmbed := make([]string, len(missing))
+	for j, i := range missing {
+		toEmbed[j] = texts[i]
+	}
+	embedded, err := c.next.EmbedBatch(ctx, toEmbed)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missing {
+		vectors[i] = embedded[j]
+		c.remember(c.cacheKey(texts[i]), embedded[j])
+	}
+	return vectors, nil
+}
+
+func (c *CachedEmbedder) Model() string {
+	return c.next.Model()
+}
+
+func (c *CachedEmbedder) Dimension() int {
+	return c.next.Dimension()
+}
+
+// Warm embeds any of queries not already cached, in batches, so popular
+// searches are served without a provider round trip from the first request.
+func (c *CachedEmbedder) Warm(ctx context.Context, queries []string) error {
+	const batchSize = 100
+
+	seen := make(map[string]bool)
+	var pending []string
+	for _, q := range queries {
+		key := c.cacheKey(q)
+		if normalizeQuery(q) == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pending = append(pending, q)
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		end := start + batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if _, err := c.EmbedBatch(ctx, pending[start:end]); err != nil {
+			return fmt.Errorf("warming embedding cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// WarmFromFile warms the cache from a file with one query per line.
+func (c *CachedEmbedder) WarmFromFile(ctx context.Context, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var queries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if q := strings.TrimSpace(scanner.Text()); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return len(queries), c.Warm(ctx, queries)
+}
+
+func (c *CachedEmbedder) Stats() CacheStats {
+	c.mu.Lock()
+	memoryEntries := c.lru.len()
+	c.mu.Unlock()
+
+	diskEntries := 0
+	if c.store != nil {
+		diskEntries = c.store.Len()
+	}
+	return CacheStats{
+		Model:         c.Model(),
+		MemoryHits:    c.memoryHits.Load(),
+		DiskHits:      c.diskHits.Load(),
+		Misses:        c.misses.Load(),
+		MemoryEntries: memoryEntries,
+		DiskEntries:   diskEntries,
+	}
+}
+
+func (c *CachedEmbedder) Close() error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Close()
+}
@@ -0,0 +1,170 @@
+package embeddings
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// countingEmbedder is a FakeEmbedder under a chosen model name that counts the
+// texts it is asked to embed.
+type countingEmbedder struct {
+	*FakeEmbedder
+	model    string
+	embedded int
+}
+
+func newCountingEmbedder(model string) *countingEmbedder {
+	return &countingEmbedder{FakeEmbedder: NewFakeEmbedder(8), model: model}
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.embedded++
+	return e.FakeEmbedder.Embed(ctx, text)
+}
+
+func (e *countingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	e.embedded += len(texts)
+	return e.FakeEmbedder.EmbedBatch(ctx, texts)
+}
+
+func (e *countingEmbedder) Model() string {
+	return e.model
+}
+
+func embed(t *testing.T, e Embedder, text string) []float64 {
+	t.Helper()
+	vector, err := e.Embed(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vector
+}
+
+func openTestStore(t *testing.T, path string) *DiskStore {
+	t.Helper()
+	store, err := OpenDiskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCachedEmbedderNormalizesQueries(t *testing.T) {
+	provider := newCountingEmbedder("model-a")
+	cache := NewCachedEmbedder(provider, 10, nil)
+
+	first := embed(t, cache, "Love thy  neighbour")
+	second := embed(t, cache, "  love THY neighbour ")
+	if provider.embedded != 1 {
+		t.Errorf("provider embedded %d texts, want 1", provider.embedded)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("normalized query returned a different vector")
+	}
+	stats := cache.Stats()
+	if stats.MemoryHits != 1 || stats.DiskHits != 0 || stats.Misses != 1 || stats.MemoryEntries != 1 {
+		t.Errorf("stats = %+v, want 1 memory hit, 1 miss, 1 entry", stats)
+	}
+}
+
+func TestCachedEmbedderEvictsLeastRecentlyUsed(t *testing.T) {
+	provider := newCountingEmbedder("model-a")
+	cache := NewCachedEmbedder(provider, 2, nil)
+
+	embed(t, cache, "a")
+	embed(t, cache, "b")
+	embed(t, cache, "a") // hit, so b is now the least recently used
+	embed(t, cache, "c") // evicts b
+	if provider.embedded != 3 {
+		t.Fatalf("provider embedded %d texts, want 3", provider.embedded)
+	}
+	embed(t, cache, "a")
+	if provider.embedded != 3 {
+		t.Errorf("a was evicted")
+	}
+	embed(t, cache, "b")
+	if provider.embedded != 4 {
+		t.Errorf("b was not evicted")
+	}
+	if n := cache.Stats().MemoryEntries; n != 2 {
+		t.Errorf("%d entries in memory, want 2", n)
+	}
+}
+
+func TestCachedEmbedderPersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	provider := newCountingEmbedder("model-a")
+	cache := NewCachedEmbedder(provider, 10, openTestStore(t, path))
+	want := embed(t, cache, "the lord is my shepherd")
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	provider = newCountingEmbedder("model-a")
+	cache = NewCachedEmbedder(provider, 10, openTestStore(t, path))
+	defer cache.Close()
+	got := embed(t, cache, "The Lord is my shepherd")
+	if provider.embedded != 0 {
+		t.Errorf("provider embedded %d texts after reopening, want 0", provider.embedded)
+	}
+	// The store keeps float32 precision.
+	for i := range want {
+		if float32(got[i]) != float32(want[i]) {
+			t.Fatalf("component %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if stats := cache.Stats(); stats.DiskHits != 1 || stats.DiskEntries != 1 {
+		t.Errorf("stats = %+v, want 1 disk hit and 1 disk entry", stats)
+	}
+}
+
+func TestCachedEmbedderKeysByModel(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	defer store.Close()
+
+	a := newCountingEmbedder("model-a")
+	embed(t, NewCachedEmbedder(a, 10, store), "grace")
+
+	b := newCountingEmbedder("model-b")
+	embed(t, NewCachedEmbedder(b, 10, store), "grace")
+	if b.embedded != 1 {
+		t.Errorf("model-b was served model-a's vector")
+	}
+	if n := store.Len(); n != 2 {
+		t.Errorf("%d entries on disk, want 2", n)
+	}
+}
+
+func TestCachedEmbedderWarmFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.txt")
+	if err := os.WriteFile(path, []byte("grace\n\n  Grace \nfaith\nhope\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := newCountingEmbedder("model-a")
+	cache := NewCachedEmbedder(provider, 10, nil)
+	n, err := cache.WarmFromFile(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("read %d queries, want 4", n)
+	}
+	if provider.embedded != 3 {
+		t.Errorf("provider embedded %d texts, want the 3 distinct queries", provider.embedded)
+	}
+
+	for _, q := range []string{"grace", "faith", "hope"} {
+		embed(t, cache, q)
+	}
+	if provider.embedded != 3 {
+		t.Errorf("warmed queries were embedded again")
+	}
+	if hits := cache.Stats().MemoryHits; hits != 3 {
+		t.Errorf("%d memory hits, want 3", hits)
+	}
+}
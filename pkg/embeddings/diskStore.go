@@ -0,0 +1,81 @@
+package embeddings
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var queryEmbeddingsBucket = []byte("query_embeddings")
+
+// DiskStore persists query embeddings in a single bbolt file so they survive restarts.
+type DiskStore struct {
+	db *bolt.DB
+}
+
+func OpenDiskStore(path string) (*DiskStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening embedding cache %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(queryEmbeddingsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening embedding cache %s: %w", path, err)
+	}
+	return &DiskStore{db: db}, nil
+}
+
+func (d *DiskStore) Get(key string) ([]float64, bool) {
+	var vector []float64
+	d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(queryEmbeddingsBucket).Get([]byte(key)); v != nil {
+			vector = decodeVector(v)
+		}
+		return nil
+	})
+	return vector, vector != nil
+}
+
+func (d *DiskStore) Put(key string, vector []float64) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queryEmbeddingsBucket).Put([]byte(key), encodeVector(vector))
+	})
+}
+
+func (d *DiskStore) Len() int {
+	n := 0
+	d.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(queryEmbeddingsBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+func (d *DiskStore) Close() error {
+	return d.db.Close()
+}
+
+// encodeVector stores each component as a little-endian float32, which is the
+// precision embedding providers return anyway.
+func encodeVector(vector []float64) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, f := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(f)))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float64 {
+	vector := make([]float64, len(buf)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return vector
+}
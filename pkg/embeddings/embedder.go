@@ -0,0 +1,96 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Embedder turns text into embedding vectors comparable with the loaded corpus.
+type Embedder interface {
+	// Embed returns the embedding for a single piece of text.
+	Embed(ctx context.Context, text string) ([]float64, error)
+	// EmbedBatch returns one embedding per input, in input order.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float64, error)
+	// Model is the name of the model producing the vectors.
+	Model() string
+	// Dimension is the length of every vector returned.
+	Dimension() int
+}
+
+const (
+	defaultEmbeddingModel     = "text-embedding-ada-002"
+	defaultEmbeddingDimension = 1536
+)
+
+// NewEmbedderFromEnv builds the Embedder selected by EMBEDDING_PROVIDER.
+//
+//	openai (default)  OPENAI_API_KEY
+//	http              EMBEDDING_BASE_URL, EMBEDDING_API_KEY (optional)
+//	fake              no external calls, deterministic vectors
+//	none              no embeddings; only keyword search and reference lookups work
+//
+// EMBEDDING_MODEL and EMBEDDING_DIMENSION override the model name and vector size.
+func NewEmbedderFromEnv() (Embedder, error) {
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	dimension := defaultEmbeddingDimension
+	if d := os.Getenv("EMBEDDING_DIMENSION"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid EMBEDDING_DIMENSION %q", d)
+		}
+		dimension = n
+	}
+
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "", "openai":
+		return NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"), model, dimension)
+	case "http":
+		baseURL := os.Getenv("EMBEDDING_BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("EMBEDDING_BASE_URL is required for the http embedding provider")
+		}
+		return NewHTTPEmbedder(baseURL, os.Getenv("EMBEDDING_API_KEY"), model, dimension), nil
+	case "fake":
+		return NewFakeEmbedder(dimension), nil
+	case "none":
+		return NewUnavailableEmbedder(errors.New("no embedding provider is configured")), nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q", provider)
+	}
+}
+
+// unavailableEmbedder stands in when no embedding provider can be used, so the
+// server still serves keyword search and reference lookups. Every embedding
+// request fails with err, as an ErrProviderUnavailable.
+type unavailableEmbedder struct {
+	err error
+}
+
+func NewUnavailableEmbedder(err error) Embedder {
+	return unavailableEmbedder{err: err}
+}
+
+func (u unavailableEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	return nil, fmt.Errorf("creating embeddings: %w: %w", ErrProviderUnavailable, u.err)
+}
+
+func (u unavailableEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	return nil, fmt.Errorf("creating embeddings: %w: %w", ErrProviderUnavailable, u.err)
+}
+
+func (u unavailableEmbedder) Model() string  { return "none" }
+func (u unavailableEmbedder) Dimension() int { return 0 }
+
+func toFloat64(v []float32) []float64 {
+	out := make([]float64, len(v))
+	for i, f := range v {
+		out[i] = float64(f)
+	}
+	return out
+}
@@ -3,32 +3,71 @@ package embeddings
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
 )
 
 type Embedding struct {
 	Location   string
 	Verse      string
-	Embedding  []float64
+	Embedding  []float32
 	Similarity float64
 	Index      int
 }
 
-// Functions: loadEmbeddings, loadEmbeddingsFromFile
-func LoadEmbeddings(embeddingByChapterCSV, embeddingByVerseCSV string) ([]Embedding, []Embedding) {
-	embeddingsByChapter := loadEmbeddingsFromFile(embeddingByChapterCSV, "chapter")
-	embeddingsByVerse := loadEmbeddingsFromFile(embeddingByVerseCSV, "verse")
+// ToFloat32 narrows a query vector to the float32 precision of the datasets.
+func ToFloat32(vector []float64) []float32 {
+	out := make([]float32, len(vector))
+	for i, f := range vector {
+		out[i] = float32(f)
+	}
+	return out
+}
+
+// Functions: loadEmbeddings, loadEmbeddingsFromFile, loadEmbeddingsFromBinary
+// A binary dataset next to a CSV (same name, .bin extension) is preferred over the CSV.
+// Errors wrap ErrInvalidDataset.
+func LoadEmbeddings(embeddingByChapterCSV, embeddingByVerseCSV string) ([]Embedding, []Embedding, error) {
+	embeddingsByChapter, err := loadDataset(embeddingByChapterCSV, "chapter")
+	if err != nil {
+		return nil, nil, err
+	}
+	embeddingsByVerse, err := loadDataset(embeddingByVerseCSV, "verse")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return embeddingsByChapter, embeddingsByVerse, nil
+}
+
+func loadDataset(file string, db string) ([]Embedding, error) {
+	if strings.HasSuffix(file, ".bin") {
+		return loadEmbeddingsFromBinary(file)
+	}
+	if bin := BinaryPath(file); fileExists(bin) {
+		return loadEmbeddingsFromBinary(bin)
+	}
+	return loadEmbeddingsFromFile(file, db)
+}
 
-	return embeddingsByChapter, embeddingsByVerse
+// BinaryPath is where the binary dataset converted from csvFile is expected.
+func BinaryPath(csvFile string) string {
+	return strings.TrimSuffix(csvFile, filepath.Ext(csvFile)) + ".bin"
 }
 
-func loadEmbeddingsFromFile(file string, db string) []Embedding {
+func fileExists(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && !info.IsDir()
+}
+
+func loadEmbeddingsFromFile(file string, db string) ([]Embedding, error) {
 	f, err := os.Open(file)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDataset, err)
 	}
 	defer f.Close()
 
@@ -55,15 +94,18 @@ func loadEmbeddingsFromFile(file string, db string) []Embedding {
 		verse := df.Elem(i, embedCol-2).String()
 		embeddingStr := df.Elem(i, embedCol).String()
 
-		// Parse the embedding string into a slice of float64
+		// Parse the embedding string into a slice of float32
 		embeddingStr = strings.TrimPrefix(embeddingStr, "[")
 		embeddingStr = strings.TrimSuffix(embeddingStr, "]")
 		embeddingValues := strings.Split(embeddingStr, ", ")
 
-		embedding := make([]float64, len(embeddingValues))
+		embedding := make([]float32, len(embeddingValues))
 		for j, v := range embeddingValues {
-			f, _ := strconv.ParseFloat(v, 64)
-			embedding[j] = f
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s row %d (%s): bad embedding value %q: %w", ErrInvalidDataset, file, i, location, v, err)
+			}
+			embedding[j] = float32(f)
 		}
 
 		// Append the Embedding struct to the embeddings slice
@@ -74,5 +116,32 @@ func loadEmbeddingsFromFile(file string, db string) []Embedding {
 			Index:     i,
 		})
 	}
-	return embeddings
+	return embeddings, nil
+}
+
+// LoadVerseTexts reads the verses of a translation that has no embeddings of
+// its own from a CSV with location and text columns. The returned Embeddings
+// carry no vectors. Errors wrap ErrInvalidDataset.
+func LoadVerseTexts(file string) ([]Embedding, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDataset, err)
+	}
+	defer f.Close()
+
+	df := dataframe.ReadCSV(f, dataframe.DetectTypes(false), dataframe.DefaultType(series.String))
+	if df.Err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidDataset, file, df.Err)
+	}
+	locationCol, textCol := df.Col("location"), df.Col("text")
+	if locationCol.Err != nil || textCol.Err != nil {
+		return nil, fmt.Errorf("%w: %s: expected location and text columns", ErrInvalidDataset, file)
+	}
+	locations, texts := locationCol.Records(), textCol.Records()
+
+	verses := make([]Embedding, len(locations))
+	for i := range locations {
+		verses[i] = Embedding{Location: locations[i], Verse: texts[i], Index: i}
+	}
+	return verses, nil
 }
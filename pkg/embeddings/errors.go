@@ -0,0 +1,19 @@
+package embeddings
+
+import "errors"
+
+// Errors returned by embedders and dataset loading are wrapped around these,
+// so callers can tell them apart with errors.Is.
+var (
+	// ErrProviderUnavailable means no embedding provider is configured or it
+	// could not be reached.
+	ErrProviderUnavailable = errors.New("embedding provider unavailable")
+	// ErrProviderFailed means the provider answered with an error or with a
+	// response that could not be used.
+	ErrProviderFailed = errors.New("embedding provider failed")
+	// ErrDimensionMismatch means two vectors that must be compared differ in
+	// length.
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+	// ErrInvalidDataset means an embeddings or text dataset could not be read.
+	ErrInvalidDataset = errors.New("invalid dataset")
+)
@@ -0,0 +1,54 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// FakeEmbedder produces deterministic unit vectors derived from a hash of the
+// input text. The same text always yields the same vector, so it can stand in
+// for a real provider in tests and offline runs.
+type FakeEmbedder struct {
+	dimension int
+}
+
+func NewFakeEmbedder(dimension int) *FakeEmbedder {
+	return &FakeEmbedder{dimension: dimension}
+}
+
+func (f *FakeEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(text))))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	vector := make([]float64, f.dimension)
+	var norm float64
+	for i := range vector {
+		vector[i] = rng.NormFloat64()
+		norm += vector[i] * vector[i]
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector, nil
+}
+
+func (f *FakeEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, t := range texts {
+		vectors[i], _ = f.Embed(ctx, t)
+	}
+	return vectors, nil
+}
+
+func (f *FakeEmbedder) Model() string {
+	return "fake"
+}
+
+func (f *FakeEmbedder) Dimension() int {
+	return f.dimension
+}
@@ -0,0 +1,106 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPEmbedder talks to any server exposing an OpenAI-compatible POST /embeddings
+// endpoint, such as a local stand-in for the OpenAI API.
+type HTTPEmbedder struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	dimension int
+	client    *http.Client
+}
+
+type httpEmbeddingRequest struct {
+	Input []string `json:"input"`
+	Model string   `json:"model"`
+}
+
+type httpEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+func NewHTTPEmbedder(baseURL string, apiKey string, model string, dimension int) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    apiKey,
+		model:     model,
+		dimension: dimension,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (h *HTTPEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := h.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (h *HTTPEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(httpEmbeddingRequest{Input: texts, Model: h.model})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("creating embeddings: %w: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("creating embeddings: %w: %s: %s", ErrProviderFailed, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var decoded httpEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("decoding embeddings response: %w: %w", ErrProviderFailed, err)
+	}
+	if len(decoded.Data) != len(texts) {
+		return nil, fmt.Errorf("creating embeddings: %w: got %d vectors for %d inputs", ErrProviderFailed, len(decoded.Data), len(texts))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range decoded.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("creating embeddings: %w: unexpected index %d", ErrProviderFailed, d.Index)
+		}
+		if len(d.Embedding) != h.dimension {
+			return nil, fmt.Errorf("creating embeddings: %w: got dimension %d, expected %d", ErrDimensionMismatch, len(d.Embedding), h.dimension)
+		}
+		vectors[d.Index] = toFloat64(d.Embedding)
+	}
+	return vectors, nil
+}
+
+func (h *HTTPEmbedder) Model() string {
+	return h.model
+}
+
+func (h *HTTPEmbedder) Dimension() int {
+	return h.dimension
+}
@@ -0,0 +1,54 @@
+package embeddings
+
+import "container/list"
+
+// lruCache is a fixed-capacity map from key to vector that evicts the least
+// recently used entry. It is not safe for concurrent use on its own.
+type lruCache struct {
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	vector []float64
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (l *lruCache) get(key string) ([]float64, bool) {
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*lruEntry).vector, true
+}
+
+func (l *lruCache) put(key string, vector []float64) {
+	if l.capacity <= 0 {
+		return
+	}
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruEntry).vector = vector
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, vector: vector})
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lruCache) len() int {
+	return l.order.Len()
+}
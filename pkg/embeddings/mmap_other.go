@@ -0,0 +1,14 @@
+//go:build !unix
+
+package embeddings
+
+import "os"
+
+// mapFile reads file into memory on platforms without mmap support.
+func mapFile(file string) (data []byte, unmap func() error, err error) {
+	data, err = os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package embeddings
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps file read-only. The returned slice is only valid until
+// unmap is called.
+func mapFile(file string) (data []byte, unmap func() error, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
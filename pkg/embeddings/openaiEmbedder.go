@@ -0,0 +1,74 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIEmbedder calls the OpenAI embeddings API through a single shared client.
+type OpenAIEmbedder struct {
+	client    *openai.Client
+	model     openai.EmbeddingModel
+	dimension int
+}
+
+func NewOpenAIEmbedder(apiKey string, model string, dimension int) (*OpenAIEmbedder, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	var m openai.EmbeddingModel
+	if err := m.UnmarshalText([]byte(model)); err != nil || m == openai.Unknown {
+		return nil, fmt.Errorf("unsupported OpenAI embedding model %q", model)
+	}
+	return &OpenAIEmbedder{
+		client:    openai.NewClient(apiKey),
+		model:     m,
+		dimension: dimension,
+	}, nil
+}
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := o.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (o *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: o.model,
+	})
+	if err != nil {
+		// An API error is an answer; anything else means OpenAI was not reached.
+		var apiErr *openai.APIError
+		if errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("creating embeddings: %w: %w", ErrProviderFailed, err)
+		}
+		return nil, fmt.Errorf("creating embeddings: %w: %w", ErrProviderUnavailable, err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("creating embeddings: %w: got %d vectors for %d inputs", ErrProviderFailed, len(resp.Data), len(texts))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("creating embeddings: %w: unexpected index %d", ErrProviderFailed, d.Index)
+		}
+		vectors[d.Index] = toFloat64(d.Embedding)
+	}
+	return vectors, nil
+}
+
+func (o *OpenAIEmbedder) Model() string {
+	return o.model.String()
+}
+
+func (o *OpenAIEmbedder) Dimension() int {
+	return o.dimension
+}
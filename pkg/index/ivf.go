@@ -0,0 +1,270 @@
+package index
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Result is one hit from an index search: the position of the vector in the
+// slice the index was built over, and its cosine similarity to the query.
+type Result struct {
+	ID    int
+	Score float64
+}
+
+// IVF is an inverted-file approximate nearest neighbour index. Vectors are
+// clustered around nlist centroids with spherical k-means; a search only scores
+// the vectors in the nprobe lists whose centroids are closest to the query.
+//
+// The index keeps a reference to the vectors it was built over and never
+// modifies them, so it is safe for concurrent searches.
+type IVF struct {
+	Dimension int
+	NProbe    int
+
+	centroids [][]float32
+	lists     [][]int
+	vectors   [][]float32
+	norms     []float64
+	checksum  uint32
+}
+
+const (
+	kmeansIterations    = 12
+	kmeansSamplePerList = 64
+)
+
+// DefaultNList is the number of lists used for a corpus of n vectors.
+func DefaultNList(n int) int {
+	nlist := int(math.Sqrt(float64(n)))
+	if nlist < 1 {
+		nlist = 1
+	}
+	return nlist
+}
+
+// DefaultNProbe is the number of lists searched when nlist lists exist.
+func DefaultNProbe(nlist int) int {
+	nprobe := nlist / 8
+	if nprobe < 4 {
+		nprobe = 4
+	}
+	if nprobe > nlist {
+		nprobe = nlist
+	}
+	return nprobe
+}
+
+// BuildIVF clusters vectors into nlist lists. seed makes the build reproducible.
+func BuildIVF(vectors [][]float32, nlist int, seed int64) *IVF {
+	if len(vectors) == 0 {
+		return newIVF(vectors)
+	}
+	if nlist > len(vectors) {
+		nlist = len(vectors)
+	}
+	if nlist < 1 {
+		nlist = 1
+	}
+	ivf := newIVF(vectors)
+	ivf.centroids = trainCentroids(vectors, ivf.norms, nlist, seed)
+	ivf.lists = ivf.assignAll()
+	ivf.NProbe = DefaultNProbe(nlist)
+	return ivf
+}
+
+func newIVF(vectors [][]float32) *IVF {
+	ivf := &IVF{
+		vectors:  vectors,
+		norms:    make([]float64, len(vectors)),
+		checksum: vectorsChecksum(vectors),
+	}
+	if len(vectors) > 0 {
+		ivf.Dimension = len(vectors[0])
+	}
+	for i, v := range vectors {
+		ivf.norms[i] = norm(v)
+	}
+	return ivf
+}
+
+// NList is the number of inverted lists.
+func (ivf *IVF) NList() int {
+	return len(ivf.centroids)
+}
+
+// Len is the number of indexed vectors.
+func (ivf *IVF) Len() int {
+	return len(ivf.vectors)
+}
+
+// Search returns up to k results ordered by descending score, probing nprobe
+// lists (the index default when nprobe <= 0).
+func (ivf *IVF) Search(query []float32, k int, nprobe int) []Result {
+	if nprobe <= 0 {
+		nprobe = ivf.NProbe
+	}
+	if nprobe > len(ivf.centroids) {
+		nprobe = len(ivf.centroids)
+	}
+	queryNorm := norm(query)
+	if queryNorm == 0 || len(query) != ivf.Dimension {
+		return nil
+	}
+
+	probes := make([]Result, len(ivf.centroids))
+	for c, centroid := range ivf.centroids {
+		probes[c] = Result{ID: c, Score: dot(query, centroid)}
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].Score > probes[j].Score
+	})
+
+	var candidates []Result
+	for _, p := range probes[:nprobe] {
+		for _, id := range ivf.lists[p.ID] {
+			candidates = append(candidates, Result{
+				ID:    id,
+				Score: dot(query, ivf.vectors[id]) / (queryNorm * ivf.norms[id]),
+			})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// BruteForce scores every vector against query and returns the top k. It is the
+// exact baseline the IVF index is measured against.
+func BruteForce(vectors [][]float32, query []float32, k int) []Result {
+	queryNorm := norm(query)
+	results := make([]Result, len(vectors))
+	for i, v := range vectors {
+		results[i] = Result{ID: i, Score: dot(query, v) / (queryNorm * norm(v))}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// trainCentroids runs spherical k-means over a sample of vectors.
+func trainCentroids(vectors [][]float32, norms []float64, nlist int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+
+	sample := rng.Perm(len(vectors))
+	if n := nlist * kmeansSamplePerList; len(sample) > n {
+		sample = sample[:n]
+	}
+
+	centroids := make([][]float32, nlist)
+	for c := range centroids {
+		centroids[c] = unit(vectors[sample[c]], norms[sample[c]])
+	}
+
+	assignment := make([]int, len(sample))
+	for iter := 0; iter < kmeansIterations; iter++ {
+		parallelFor(len(sample), func(i int) {
+			assignment[i] = nearestCentroid(centroids, vectors[sample[i]])
+		})
+
+		dimension := len(vectors[0])
+		sums := make([][]float64, nlist)
+		counts := make([]int, nlist)
+		for c := range sums {
+			sums[c] = make([]float64, dimension)
+		}
+		for i, c := range assignment {
+			v, n := vectors[sample[i]], norms[sample[i]]
+			for d := range v {
+				sums[c][d] += float64(v[d]) / n
+			}
+			counts[c]++
+		}
+		for c := range centroids {
+			if counts[c] == 0 {
+				// Reseed empty clusters from a random sample point.
+				id := sample[rng.Intn(len(sample))]
+				centroids[c] = unit(vectors[id], norms[id])
+				continue
+			}
+			centroid := make([]float32, dimension)
+			for d, sum := range sums[c] {
+				centroid[d] = float32(sum)
+			}
+			centroids[c] = unit(centroid, norm(centroid))
+		}
+	}
+	return centroids
+}
+
+func (ivf *IVF) assignAll() [][]int {
+	assignment := make([]int, len(ivf.vectors))
+	parallelFor(len(ivf.vectors), func(i int) {
+		assignment[i] = nearestCentroid(ivf.centroids, ivf.vectors[i])
+	})
+	lists := make([][]int, len(ivf.centroids))
+	for id, c := range assignment {
+		lists[c] = append(lists[c], id)
+	}
+	return lists
+}
+
+func nearestCentroid(centroids [][]float32, v []float32) int {
+	best, bestScore := 0, math.Inf(-1)
+	for c, centroid := range centroids {
+		if s := dot(v, centroid); s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+	return best
+}
+
+func parallelFor(n int, fn func(i int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				fn(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// dot accumulates in float64 so that long float32 vectors keep their precision.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func norm(v []float32) float64 {
+	return math.Sqrt(dot(v, v))
+}
+
+func unit(v []float32, n float64) []float32 {
+	out := make([]float32, len(v))
+	if n == 0 {
+		return out
+	}
+	for i := range v {
+		out[i] = float32(float64(v[i]) / n)
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// IVF file layout, all integers little-endian:
+//
+//	magic     [4]byte "GSIV"
+//	version   uint16
+//	dimension uint32
+//	rows      uint32   number of vectors the index was built over
+//	checksum  uint32   CRC-32 of those vectors, to detect a stale index
+//	nlist     uint32
+//	nprobe    uint32
+//	centroids nlist*dimension float32
+//	lists     nlist * (count uint32, count*uint32 ids)
+const (
+	ivfMagic   = "GSIV"
+	ivfVersion = 1
+)
+
+// ErrStaleIndex is returned when an index file was built over different vectors.
+var ErrStaleIndex = errors.New("index does not match the dataset")
+
+// Save writes the index to w. The vectors themselves are not stored; they are
+// supplied again when the index is loaded.
+func (ivf *IVF) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	buf = append(buf, ivfMagic...)
+	buf = binary.LittleEndian.AppendUint16(buf, ivfVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ivf.Dimension))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ivf.vectors)))
+	buf = binary.LittleEndian.AppendUint32(buf, ivf.checksum)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ivf.centroids)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(ivf.NProbe))
+	for _, centroid := range ivf.centroids {
+		for _, f := range centroid {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+	}
+	for _, list := range ivf.lists {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(list)))
+		for _, id := range list {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(id))
+		}
+	}
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// LoadIVF reads an index saved with Save and attaches it to vectors, which must
+// be the same vectors it was built over.
+func LoadIVF(r io.Reader, vectors [][]float32) (*IVF, error) {
+	br := bufio.NewReader(r)
+	var header struct {
+		Magic     [4]byte
+		Version   uint16
+		Dimension uint32
+		Rows      uint32
+		Checksum  uint32
+		NList     uint32
+		NProbe    uint32
+	}
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != ivfMagic {
+		return nil, errors.New("not an IVF index file")
+	}
+	if header.Version != ivfVersion {
+		return nil, fmt.Errorf("unsupported IVF index version %d", header.Version)
+	}
+
+	ivf := newIVF(vectors)
+	if int(header.Rows) != len(vectors) || int(header.Dimension) != ivf.Dimension || header.Checksum != ivf.checksum {
+		return nil, ErrStaleIndex
+	}
+	if header.NList > header.Rows {
+		return nil, errors.New("corrupt IVF index header")
+	}
+	ivf.NProbe = int(header.NProbe)
+
+	ivf.centroids = make([][]float32, header.NList)
+	for c := range ivf.centroids {
+		centroid := make([]float32, int(header.Dimension))
+		if err := binary.Read(br, binary.LittleEndian, centroid); err != nil {
+			return nil, err
+		}
+		ivf.centroids[c] = centroid
+	}
+
+	ivf.lists = make([][]int, header.NList)
+	for c := range ivf.lists {
+		var count uint32
+		if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+			return nil, err
+		}
+		if int(count) > len(vectors) {
+			return nil, errors.New("corrupt IVF index list")
+		}
+		ids := make([]uint32, count)
+		if err := binary.Read(br, binary.LittleEndian, ids); err != nil {
+			return nil, err
+		}
+		list := make([]int, count)
+		for i, id := range ids {
+			if int(id) >= len(vectors) {
+				return nil, errors.New("corrupt IVF index list")
+			}
+			list[i] = int(id)
+		}
+		ivf.lists[c] = list
+	}
+	return ivf, nil
+}
+
+// LoadOrBuildIVF loads the index at file when it matches vectors, and otherwise
+// builds a new one and tries to save it there for next time. The returned index
+// is usable even when saving fails.
+func LoadOrBuildIVF(file string, vectors [][]float32) (*IVF, error) {
+	if f, err := os.Open(file); err == nil {
+		ivf, err := LoadIVF(f, vectors)
+		f.Close()
+		if err == nil {
+			return ivf, nil
+		}
+		fmt.Printf("Rebuilding ANN index %s: %s\n", file, err)
+	}
+
+	ivf := BuildIVF(vectors, DefaultNList(len(vectors)), 1)
+	f, err := os.Create(file)
+	if err != nil {
+		return ivf, err
+	}
+	if err := ivf.Save(f); err != nil {
+		f.Close()
+		return ivf, err
+	}
+	return ivf, f.Close()
+}
+
+func vectorsChecksum(vectors [][]float32) uint32 {
+	crc := crc32.NewIEEE()
+	var buf []byte
+	for _, v := range vectors {
+		buf = buf[:0]
+		for _, f := range v {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+		crc.Write(buf)
+	}
+	return crc.Sum32()
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// clusteredVectors returns n vectors scattered around a few random centres, the
+// shape of data an IVF index is built for.
+func clusteredVectors(n, dimension, clusters int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	centres := make([][]float32, clusters)
+	for c := range centres {
+		centres[c] = make([]float32, dimension)
+		for d := range centres[c] {
+			centres[c][d] = float32(rng.NormFloat64())
+		}
+	}
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		centre := centres[rng.Intn(clusters)]
+		vectors[i] = make([]float32, dimension)
+		for d := range vectors[i] {
+			vectors[i][d] = centre[d] + float32(rng.NormFloat64()*0.3)
+		}
+	}
+	return vectors
+}
+
+func ids(results []Result) []int {
+	out := make([]int, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	vectors := clusteredVectors(500, 16, 10, 1)
+	built := BuildIVF(vectors, DefaultNList(len(vectors)), 1)
+
+	var buf bytes.Buffer
+	if err := built.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIVF(&buf, vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Dimension != built.Dimension || loaded.NProbe != built.NProbe || loaded.NList() != built.NList() || loaded.Len() != built.Len() {
+		t.Fatalf("loaded index %d/%d/%d/%d, built %d/%d/%d/%d",
+			loaded.Dimension, loaded.NProbe, loaded.NList(), loaded.Len(),
+			built.Dimension, built.NProbe, built.NList(), built.Len())
+	}
+	if !reflect.DeepEqual(loaded.lists, built.lists) {
+		t.Error("loaded lists differ from the built ones")
+	}
+	for _, q := range vectors[:20] {
+		if got, want := ids(loaded.Search(q, 10, 0)), ids(built.Search(q, 10, 0)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("loaded index found %v, built index found %v", got, want)
+		}
+	}
+}
+
+func TestLoadIVFRejectsChangedVectors(t *testing.T) {
+	vectors := clusteredVectors(200, 8, 5, 1)
+	var buf bytes.Buffer
+	if err := BuildIVF(vectors, 8, 1).Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	changed := append([][]float32(nil), vectors...)
+	changed[17] = append([]float32(nil), vectors[17]...)
+	changed[17][3] += 0.5
+	tests := map[string][][]float32{
+		"changed vector": changed,
+		"fewer rows":     vectors[:199],
+		"other vectors":  clusteredVectors(200, 8, 5, 2),
+	}
+	for name, vectors := range tests {
+		if _, err := LoadIVF(bytes.NewReader(saved), vectors); !errors.Is(err, ErrStaleIndex) {
+			t.Errorf("%s: err = %v, want ErrStaleIndex", name, err)
+		}
+	}
+}
+
+func TestLoadOrBuildIVFRebuildsStaleIndex(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "verses.ivf")
+	vectors := clusteredVectors(300, 8, 6, 1)
+	if _, err := LoadOrBuildIVF(file, vectors); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the same vectors again leaves the saved index alone.
+	if _, err := LoadOrBuildIVF(file, vectors); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(file); !bytes.Equal(again, first) {
+		t.Error("index was rewritten for unchanged vectors")
+	}
+
+	changed := clusteredVectors(300, 8, 6, 2)
+	ivf, err := LoadOrBuildIVF(file, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(ivf.Search(changed[0], 1, ivf.NList())), ids(BruteForce(changed, changed[0], 1)); !reflect.DeepEqual(got, want) {
+		t.Errorf("rebuilt index found %v, want %v", got, want)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := LoadIVF(f, changed); err != nil {
+		t.Errorf("rebuilt index was not saved: %v", err)
+	}
+}
+
+func TestSearchRecall(t *testing.T) {
+	vectors := clusteredVectors(2000, 16, 40, 1)
+	ivf := BuildIVF(vectors, DefaultNList(len(vectors)), 1)
+
+	rng := rand.New(rand.NewSource(2))
+	const k, numQueries = 10, 50
+	found := 0
+	for i := 0; i < numQueries; i++ {
+		base := vectors[rng.Intn(len(vectors))]
+		query := make([]float32, len(base))
+		for d := range base {
+			query[d] = base[d] + float32(rng.NormFloat64()*0.1)
+		}
+
+		exact := map[int]bool{}
+		for _, r := range BruteForce(vectors, query, k) {
+			exact[r.ID] = true
+		}
+		for _, r := range ivf.Search(query, k, 0) {
+			if exact[r.ID] {
+				found++
+			}
+		}
+
+		// Probing every list is exact.
+		if got, want := ids(ivf.Search(query, k, ivf.NList())), ids(BruteForce(vectors, query, k)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("full probe found %v, brute force %v", got, want)
+		}
+	}
+	if recall := float64(found) / (k * numQueries); recall < 0.9 {
+		t.Errorf("recall@%d = %.3f, want at least 0.9", k, recall)
+	}
+}
@@ -0,0 +1,104 @@
+// Package keyword is a lexical BM25 index over verse text, for queries that
+// name words rather than topics. It needs no embedding provider.
+package keyword
+
+import (
+	"math"
+	"sort"
+)
+
+// Result is one hit from a keyword search: the position of the document in
+// the slice the index was built over, and its BM25 score.
+type Result struct {
+	ID    int
+	Score float64
+}
+
+// BM25 parameters: k1 caps how much repeating a term helps, b how much long
+// documents are penalized.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+type posting struct {
+	doc  int
+	freq int
+}
+
+// Index is an inverted index from term to the documents containing it. It is
+// read-only once built and safe for concurrent searches.
+type Index struct {
+	postings  map[string][]posting
+	docLength []int
+	avgLength float64
+}
+
+// Build indexes docs; a document's ID in results is its position in docs.
+func Build(docs []string) *Index {
+	idx := &Index{
+		postings:  make(map[string][]posting),
+		docLength: make([]int, len(docs)),
+	}
+	total := 0
+	for id, doc := range docs {
+		terms := Tokenize(doc)
+		idx.docLength[id] = len(terms)
+		total += len(terms)
+
+		freqs := make(map[string]int)
+		for _, t := range terms {
+			freqs[t]++
+		}
+		for t, f := range freqs {
+			idx.postings[t] = append(idx.postings[t], posting{doc: id, freq: f})
+		}
+	}
+	if len(docs) > 0 {
+		idx.avgLength = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+// Len is the number of documents indexed.
+func (idx *Index) Len() int {
+	return len(idx.docLength)
+}
+
+// Search scores every document containing a query term and returns them by
+// descending score.
+func (idx *Index) Search(query string) []Result {
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	n := float64(len(idx.docLength))
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := k1 * (1 - b + b*float64(idx.docLength[p.doc])/idx.avgLength)
+			scores[p.doc] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
@@ -0,0 +1,74 @@
+package keyword
+
+import (
+	"math"
+	"testing"
+)
+
+var verses = []string{
+	"And Melchizedek king of Salem brought forth bread and wine: and he was the priest of the most high God.",
+	"The LORD is my shepherd; I shall not want.",
+	"The LORD hath sworn, and will not repent, Thou art a priest for ever after the order of Melchizedek.",
+	"For God so loved the world, that he gave his only begotten Son.",
+	"For this Melchisedec, king of Salem, priest of the most high God, met Abraham.",
+}
+
+func TestSearch(t *testing.T) {
+	idx := Build(verses)
+	if idx.Len() != len(verses) {
+		t.Fatalf("Len() = %d, want %d", idx.Len(), len(verses))
+	}
+
+	results := idx.Search("Melchizedek")
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want the 2 verses containing Melchizedek: %+v", len(results), results)
+	}
+	for _, r := range results {
+		if r.ID != 0 && r.ID != 2 {
+			t.Errorf("verse %d does not contain Melchizedek", r.ID)
+		}
+	}
+	// One occurrence each, so the shorter verse scores higher.
+	if results[0].ID != 2 || results[0].Score <= results[1].Score {
+		t.Errorf("results = %+v, want verse 2 ranked above verse 0", results)
+	}
+}
+
+func TestSearchRanksRareTermsHigher(t *testing.T) {
+	idx := Build(verses)
+	results := idx.Search("priest Melchizedek")
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(results), results)
+	}
+	// Verse 4 only has "priest", which three verses share, so it ranks below
+	// both verses naming Melchizedek.
+	if results[2].ID != 4 {
+		t.Errorf("results = %+v, want verse 4 last", results)
+	}
+}
+
+func TestSearchModernizesQueries(t *testing.T) {
+	idx := Build(verses)
+	results := idx.Search("you are a priest forever")
+	if len(results) == 0 || results[0].ID != 2 {
+		t.Errorf("results = %+v, want verse 2 first", results)
+	}
+	if got := idx.Search("thou"); len(got) != len(idx.Search("you")) {
+		t.Errorf("thou and you matched %d and %d verses", len(got), len(idx.Search("you")))
+	}
+}
+
+func TestSearchNoMatches(t *testing.T) {
+	idx := Build(verses)
+	if results := idx.Search("Nebuchadnezzar"); len(results) != 0 {
+		t.Errorf("results = %+v, want none", results)
+	}
+	if results := Build(nil).Search("God"); len(results) != 0 {
+		t.Errorf("empty index results = %+v, want none", results)
+	}
+	for _, r := range idx.Search("God God God") {
+		if math.IsNaN(r.Score) || r.Score <= 0 {
+			t.Errorf("verse %d scored %v", r.ID, r.Score)
+		}
+	}
+}
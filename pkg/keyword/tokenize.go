@@ -0,0 +1,78 @@
+package keyword
+
+import (
+	"strings"
+	"unicode"
+)
+
+// archaicForms maps Early Modern English words found in the KJV to the modern
+// words users type, so "thou hast" matches "you have" and the reverse. "art"
+// is left alone: it is also a noun.
+var archaicForms = map[string]string{
+	"thee": "you", "thou": "you", "ye": "you", "thy": "your", "thine": "your",
+	"hath": "have", "hast": "have", "doth": "do", "dost": "do", "saith": "say",
+	"shalt": "shall", "wilt": "will", "spake": "spoke",
+	"unto": "to", "hither": "here", "thither": "there", "whither": "where",
+	"wherefore": "why", "yea": "yes", "nay": "no", "aught": "anything",
+	"naught": "nothing", "brethren": "brother", "kine": "cow", "twain": "two",
+}
+
+// suffixes are stripped longest first. -eth and -est cover KJV verb forms
+// ("loveth", "goest"); the rest are common English inflections.
+var suffixes = []string{"eth", "est", "ing", "edst", "ed", "es", "s"}
+
+const minStemLength = 3
+
+// minVerbStemLength lets -eth and -est come off short verbs ending in a vowel,
+// so "goest" and "goeth" meet "go".
+const minVerbStemLength = 2
+
+// Tokenize splits text into normalized terms: lowercased words with archaic
+// forms modernized and inflections stripped, so "He that loveth" and "loves"
+// share the term "lov". Queries and verses must go through the same function.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		// Possessives: "God's" indexes as "god".
+		w = strings.TrimSuffix(strings.Trim(w, "'"), "'s")
+		if w == "" {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
+
+func stem(word string) string {
+	if modern, ok := archaicForms[word]; ok {
+		word = modern
+	}
+	for _, suffix := range suffixes {
+		if !strings.HasSuffix(word, suffix) {
+			continue
+		}
+		if base := word[:len(word)-len(suffix)]; len(base) < minStemLength && !isVerbStem(base, suffix) {
+			continue
+		}
+		// "bless" and "glass" are not plurals.
+		if suffix == "s" && strings.HasSuffix(word, "ss") {
+			break
+		}
+		word = strings.TrimSuffix(word, suffix)
+		break
+	}
+	// "love" and "lov(eth)" meet at "lov".
+	if len(word) > minStemLength && strings.HasSuffix(word, "e") {
+		word = strings.TrimSuffix(word, "e")
+	}
+	return word
+}
+
+func isVerbStem(base, suffix string) bool {
+	return (suffix == "eth" || suffix == "est") && len(base) >= minVerbStemLength &&
+		strings.ContainsRune("aeiou", rune(base[len(base)-1]))
+}
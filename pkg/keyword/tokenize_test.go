@@ -0,0 +1,36 @@
+package keyword
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"lowercase and punctuation", "In the beginning, God created.", []string{"in", "the", "beginn", "god", "creat"}},
+		{"possessive", "God's word", []string{"god", "word"}},
+		{"archaic forms", "thou hast", []string{"you", "hav"}},
+		{"archaic and modern forms meet", "you have", []string{"you", "hav"}},
+		{"eth", "He that loveth", []string{"he", "that", "lov"}},
+		{"est", "thou lovest", []string{"you", "lov"}},
+		{"eth on a short verb", "goeth", []string{"go"}},
+		{"est on a short verb", "whither thou goest", []string{"wher", "you", "go"}},
+		{"short words keep their ending", "rest best", []string{"rest", "best"}},
+		{"art is a noun", "art", []string{"art"}},
+		{"not a plural", "bless", []string{"bless"}},
+		{"plural", "loves", []string{"lov"}},
+		{"digits", "7 times 70", []string{"7", "tim", "70"}},
+		{"empty", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package quote finds half-remembered quotations in verse text, tolerating
+// typos, missing or extra words, and quotes that run across a verse break.
+package quote
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Match is a quotation found in one verse, or in a verse and the one after it.
+// Start and End are byte offsets of the matched span in the verses' text
+// joined with a single space.
+type Match struct {
+	Docs  []int
+	Start int
+	End   int
+	// Score is the share of the query matched, from 0 to 1.
+	Score float64
+}
+
+type token struct {
+	text       string
+	start, end int
+}
+
+// Index holds the tokenized verses and a trigram index over their words. It
+// is read-only once built and safe for concurrent searches.
+type Index struct {
+	texts  []string
+	tokens [][]token
+	next   []int
+	grams  map[string][]int
+}
+
+// Alignment scores: a word typed exactly, a word with a typo, a wrong word,
+// and a word skipped on either side.
+const (
+	exactScore    = 1.0
+	typoScore     = 0.7
+	mismatchScore = -0.6
+	gapScore      = -0.5
+)
+
+// candidates is how many verses, ranked by shared trigrams, are aligned
+// against the query.
+const candidates = 40
+
+// Build indexes texts. next[i] is the position in texts of the verse that
+// follows verse i, or -1, so quotes may continue across the break.
+func Build(texts []string, next []int) *Index {
+	idx := &Index{
+		texts:  texts,
+		tokens: make([][]token, len(texts)),
+		next:   next,
+		grams:  make(map[string][]int),
+	}
+	for i, text := range texts {
+		idx.tokens[i] = tokenize(text)
+		seen := make(map[string]bool)
+		for _, t := range idx.tokens[i] {
+			for _, g := range trigrams(t.text) {
+				if !seen[g] {
+					seen[g] = true
+					idx.grams[g] = append(idx.grams[g], i)
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// Find returns the best matches for query, best first, at most limit of them.
+func (idx *Index) Find(query string, limit int) []Match {
+	words := tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+	queryWords := make([]string, len(words))
+	for i, w := range words {
+		queryWords[i] = w.text
+	}
+
+	var matches []Match
+	seen := make(map[int]bool)
+	for _, doc := range idx.candidates(queryWords) {
+		best := idx.align(queryWords, []int{doc})
+		if next := idx.next[doc]; next >= 0 {
+			if m := idx.align(queryWords, []int{doc, next}); m.Score > best.Score && len(m.Docs) > 1 {
+				best = m
+			}
+		}
+		if best.Score <= 0 || seen[best.Docs[0]] {
+			continue
+		}
+		seen[best.Docs[0]] = true
+		matches = append(matches, best)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// candidates ranks verses by how many of the query's word trigrams they share.
+func (idx *Index) candidates(words []string) []int {
+	counts := make(map[int]int)
+	seen := make(map[string]bool)
+	for _, w := range words {
+		for _, g := range trigrams(w) {
+			if seen[g] {
+				continue
+			}
+			seen[g] = true
+			for _, doc := range idx.grams[g] {
+				counts[doc]++
+			}
+		}
+	}
+
+	docs := make([]int, 0, len(counts))
+	for doc := range counts {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if counts[docs[i]] != counts[docs[j]] {
+			return counts[docs[i]] > counts[docs[j]]
+		}
+		return docs[i] < docs[j]
+	})
+	if len(docs) > candidates {
+		docs = docs[:candidates]
+	}
+	return docs
+}
+
+// align finds the best local alignment of the query words against the words
+// of docs read as one text (Smith-Waterman over words).
+func (idx *Index) align(query []string, docs []int) Match {
+	var words []token
+	offset := 0
+	for i, doc := range docs {
+		if i > 0 {
+			offset++ // the joining space
+		}
+		for _, t := range idx.tokens[doc] {
+			words = append(words, token{t.text, t.start + offset, t.end + offset})
+		}
+		offset += len(idx.texts[doc])
+	}
+
+	type cell struct {
+		score float64
+		start int
+	}
+	prev := make([]cell, len(words)+1)
+	cur := make([]cell, len(words)+1)
+	best, bestStart, bestEnd := 0.0, 0, 0
+	for i := 1; i <= len(query); i++ {
+		cur[0] = cell{}
+		for j := 1; j <= len(words); j++ {
+			c := cell{start: j - 1}
+			if diag := prev[j-1].score + similarity(query[i-1], words[j-1].text); diag > c.score {
+				c = cell{diag, prev[j-1].start}
+				if prev[j-1].score == 0 {
+					c.start = j - 1
+				}
+			}
+			if up := prev[j].score + gapScore; up > c.score {
+				c = cell{up, prev[j].start}
+			}
+			if left := cur[j-1].score + gapScore; left > c.score {
+				c = cell{left, cur[j-1].start}
+			}
+			cur[j] = c
+			if c.score > best {
+				best, bestStart, bestEnd = c.score, c.start, j-1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	if best == 0 {
+		return Match{}
+	}
+
+	m := Match{
+		Start: words[bestStart].start,
+		End:   words[bestEnd].end,
+		Score: best / float64(len(query)),
+	}
+	if m.Score > 1 {
+		m.Score = 1
+	}
+	// Only keep the second verse if the match reaches into it.
+	m.Docs = docs[:1]
+	if len(docs) > 1 && m.End > len(idx.texts[docs[0]]) {
+		m.Docs = docs
+	}
+	return m
+}
+
+func similarity(a, b string) float64 {
+	if a == b {
+		return exactScore
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest >= 4 && editDistance(a, b) <= longest/3 {
+		return typoScore
+	}
+	return mismatchScore
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// tokenize splits text into lowercased words, keeping each word's byte offsets
+// in text.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text + " " {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// trigrams returns the character trigrams of a word padded with a space at
+// each end, so short words still produce some.
+func trigrams(word string) []string {
+	padded := " " + word + " "
+	if len(padded) < 3 {
+		return nil
+	}
+	grams := make([]string, 0, len(padded)-2)
+	for i := 0; i+3 <= len(padded); i++ {
+		grams = append(grams, padded[i:i+3])
+	}
+	return grams
+}
@@ -0,0 +1,120 @@
+package quote
+
+import (
+	"reflect"
+	"testing"
+)
+
+var psalms = []string{
+	"The LORD is my shepherd; I shall not want.",
+	"He maketh me to lie down in green pastures: he leadeth me beside the still waters.",
+	"He restoreth my soul: he leadeth me in the paths of righteousness for his name's sake.",
+	"For God so loved the world, that he gave his only begotten Son, that whosoever believeth in him should not perish, but have everlasting life.",
+	"For God sent not his Son into the world to condemn the world; but that the world through him might be saved.",
+}
+
+// Each text is followed by the next, except that text 2 ends its passage.
+var next = []int{1, 2, -1, 4, -1}
+
+func TestFind(t *testing.T) {
+	idx := Build(psalms, next)
+	tests := []struct {
+		name  string
+		query string
+		docs  []int
+		span  string
+		exact bool
+	}{
+		{
+			name:  "typo",
+			query: "the lord is my shepard i shall not want",
+			docs:  []int{0},
+			span:  "The LORD is my shepherd; I shall not want",
+		},
+		{
+			name:  "exact",
+			query: "he restoreth my soul",
+			docs:  []int{2},
+			span:  "He restoreth my soul",
+			exact: true,
+		},
+		{
+			name:  "missing word",
+			query: "lie down in pastures",
+			docs:  []int{1},
+			span:  "lie down in green pastures",
+		},
+		{
+			name:  "across a verse break",
+			query: "should not perish but have everlasting life for god sent not his son",
+			docs:  []int{3, 4},
+			span:  "should not perish, but have everlasting life. For God sent not his Son",
+			exact: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := idx.Find(tt.query, 1)
+			if len(matches) != 1 {
+				t.Fatalf("got %d matches, want 1", len(matches))
+			}
+			m := matches[0]
+			if !reflect.DeepEqual(m.Docs, tt.docs) {
+				t.Errorf("Docs = %v, want %v", m.Docs, tt.docs)
+			}
+			text := psalms[m.Docs[0]]
+			for _, doc := range m.Docs[1:] {
+				text += " " + psalms[doc]
+			}
+			if got := text[m.Start:m.End]; got != tt.span {
+				t.Errorf("span = %q, want %q", got, tt.span)
+			}
+			if tt.exact && m.Score != 1 {
+				t.Errorf("Score = %v, want 1", m.Score)
+			}
+			if m.Score <= 0 || m.Score > 1 {
+				t.Errorf("Score = %v, want in (0, 1]", m.Score)
+			}
+		})
+	}
+}
+
+func TestFindDoesNotCrossPassageEnds(t *testing.T) {
+	idx := Build(psalms, next)
+	matches := idx.Find("for his name's sake for god so loved the world", 0)
+	if len(matches) == 0 {
+		t.Fatal("got no matches")
+	}
+	for _, m := range matches {
+		if len(m.Docs) > 1 && m.Docs[1] != next[m.Docs[0]] {
+			t.Errorf("match %+v joins verses that do not follow each other", m)
+		}
+	}
+}
+
+func TestFindNoMatch(t *testing.T) {
+	idx := Build(psalms, next)
+	if matches := idx.Find("", 5); len(matches) != 0 {
+		t.Errorf("empty query matched %+v", matches)
+	}
+	if matches := idx.Find("xylophone", 5); len(matches) != 0 {
+		t.Errorf("unrelated query matched %+v", matches)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"shepherd", "shepherd", 0},
+		{"shepard", "shepherd", 2},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package reference
+
+import "strings"
+
+type Testament string
+
+const (
+	OldTestament Testament = "OT"
+	NewTestament Testament = "NT"
+)
+
+// Book is one book of the 66-book Protestant canon.
+type Book struct {
+	// Name is the canonical name, as used in corpus locations ("1 Corinthians").
+	Name string
+	// OSIS is the OSIS book identifier ("1Cor").
+	OSIS      string
+	Testament Testament
+	// Order is the book's 1-based position in canonical order.
+	Order    int
+	Chapters int
+}
+
+// Books lists every book in canonical order.
+var Books = []Book{
+	{"Genesis", "Gen", OldTestament, 1, 50},
+	{"Exodus", "Exod", OldTestament, 2, 40},
+	{"Leviticus", "Lev", OldTestament, 3, 27},
+	{"Numbers", "Num", OldTestament, 4, 36},
+	{"Deuteronomy", "Deut", OldTestament, 5, 34},
+	{"Joshua", "Josh", OldTestament, 6, 24},
+	{"Judges", "Judg", OldTestament, 7, 21},
+	{"Ruth", "Ruth", OldTestament, 8, 4},
+	{"1 Samuel", "1Sam", OldTestament, 9, 31},
+	{"2 Samuel", "2Sam", OldTestament, 10, 24},
+	{"1 Kings", "1Kgs", OldTestament, 11, 22},
+	{"2 Kings", "2Kgs", OldTestament, 12, 25},
+	{"1 Chronicles", "1Chr", OldTestament, 13, 29},
+	{"2 Chronicles", "2Chr", OldTestament, 14, 36},
+	{"Ezra", "Ezra", OldTestament, 15, 10},
+	{"Nehemiah", "Neh", OldTestament, 16, 13},
+	{"Esther", "Esth", OldTestament, 17, 10},
+	{"Job", "Job", OldTestament, 18, 42},
+	{"Psalms", "Ps", OldTestament, 19, 150},
+	{"Proverbs", "Prov", OldTestament, 20, 31},
+	{"Ecclesiastes", "Eccl", OldTestament, 21, 12},
+	{"Song of Solomon", "Song", OldTestament, 22, 8},
+	{"Isaiah", "Isa", OldTestament, 23, 66},
+	{"Jeremiah", "Jer", OldTestament, 24, 52},
+	{"Lamentations", "Lam", OldTestament, 25, 5},
+	{"Ezekiel", "Ezek", OldTestament, 26, 48},
+	{"Daniel", "Dan", OldTestament, 27, 12},
+	{"Hosea", "Hos", OldTestament, 28, 14},
+	{"Joel", "Joel", OldTestament, 29, 3},
+	{"Amos", "Amos", OldTestament, 30, 9},
+	{"Obadiah", "Obad", OldTestament, 31, 1},
+	{"Jonah", "Jonah", OldTestament, 32, 4},
+	{"Micah", "Mic", OldTestament, 33, 7},
+	{"Nahum", "Nah", OldTestament, 34, 3},
+	{"Habakkuk", "Hab", OldTestament, 35, 3},
+	{"Zephaniah", "Zeph", OldTestament, 36, 3},
+	{"Haggai", "Hag", OldTestament, 37, 2},
+	{"Zechariah", "Zech", OldTestament, 38, 14},
+	{"Malachi", "Mal", OldTestament, 39, 4},
+	{"Matthew", "Matt", NewTestament, 40, 28},
+	{"Mark", "Mark", NewTestament, 41, 16},
+	{"Luke", "Luke", NewTestament, 42, 24},
+	{"John", "John", NewTestament, 43, 21},
+	{"Acts", "Acts", NewTestament, 44, 28},
+	{"Romans", "Rom", NewTestament, 45, 16},
+	{"1 Corinthians", "1Cor", NewTestament, 46, 16},
+	{"2 Corinthians", "2Cor", NewTestament, 47, 13},
+	{"Galatians", "Gal", NewTestament, 48, 6},
+	{"Ephesians", "Eph", NewTestament, 49, 6},
+	{"Philippians", "Phil", NewTestament, 50, 4},
+	{"Colossians", "Col", NewTestament, 51, 4},
+	{"1 Thessalonians", "1Thess", NewTestament, 52, 5},
+	{"2 Thessalonians", "2Thess", NewTestament, 53, 3},
+	{"1 Timothy", "1Tim", NewTestament, 54, 6},
+	{"2 Timothy", "2Tim", NewTestament, 55, 4},
+	{"Titus", "Titus", NewTestament, 56, 3},
+	{"Philemon", "Phlm", NewTestament, 57, 1},
+	{"Hebrews", "Heb", NewTestament, 58, 13},
+	{"James", "Jas", NewTestament, 59, 5},
+	{"1 Peter", "1Pet", NewTestament, 60, 5},
+	{"2 Peter", "2Pet", NewTestament, 61, 3},
+	{"1 John", "1John", NewTestament, 62, 5},
+	{"2 John", "2John", NewTestament, 63, 1},
+	{"3 John", "3John", NewTestament, 64, 1},
+	{"Jude", "Jude", NewTestament, 65, 1},
+	{"Revelation", "Rev", NewTestament, 66, 22},
+}
+
+// bookAbbreviations lists the accepted short forms of each book, keyed by OSIS
+// id. Numbered books list the forms without their number; "1 ", "2 " or "3 "
+// is prefixed when the alias table is built.
+var bookAbbreviations = map[string][]string{
+	"Gen":    {"gen", "ge", "gn"},
+	"Exod":   {"exod", "exo", "ex"},
+	"Lev":    {"lev", "le", "lv"},
+	"Num":    {"num", "nu", "nm", "nb"},
+	"Deut":   {"deut", "de", "dt"},
+	"Josh":   {"josh", "jos", "jsh"},
+	"Judg":   {"judg", "jdg", "jg", "jdgs"},
+	"Ruth":   {"rth", "ru"},
+	"1Sam":   {"sam", "sa", "sm"},
+	"2Sam":   {"sam", "sa", "sm"},
+	"1Kgs":   {"kgs", "ki", "kin"},
+	"2Kgs":   {"kgs", "ki", "kin"},
+	"1Chr":   {"chr", "chron", "ch"},
+	"2Chr":   {"chr", "chron", "ch"},
+	"Ezra":   {"ezr"},
+	"Neh":    {"neh", "ne"},
+	"Esth":   {"esth", "est", "es"},
+	"Job":    {"jb"},
+	"Ps":     {"ps", "psa", "psalm", "pslm", "psm", "pss", "pslam", "pslams"},
+	"Prov":   {"prov", "pro", "prv", "pr"},
+	"Eccl":   {"eccl", "ecc", "ec", "eccles", "qoh"},
+	"Song":   {"song", "sos", "so", "sng", "song of songs", "canticles"},
+	"Isa":    {"isa", "is"},
+	"Jer":    {"jer", "je", "jr"},
+	"Lam":    {"lam", "la"},
+	"Ezek":   {"ezek", "eze", "ezk"},
+	"Dan":    {"dan", "da", "dn"},
+	"Hos":    {"hos", "ho"},
+	"Joel":   {"jl"},
+	"Amos":   {"am"},
+	"Obad":   {"obad", "ob"},
+	"Jonah":  {"jon", "jnh"},
+	"Mic":    {"mic", "mc"},
+	"Nah":    {"nah", "na"},
+	"Hab":    {"hab", "hb"},
+	"Zeph":   {"zeph", "zep", "zp"},
+	"Hag":    {"hag", "hg"},
+	"Zech":   {"zech", "zec", "zc"},
+	"Mal":    {"mal", "ml"},
+	"Matt":   {"matt", "mat", "mt"},
+	"Mark":   {"mrk", "mk", "mr"},
+	"Luke":   {"luk", "lk"},
+	"John":   {"jn", "jhn", "joh"},
+	"Acts":   {"act", "ac"},
+	"Rom":    {"rom", "ro", "rm"},
+	"1Cor":   {"cor", "co"},
+	"2Cor":   {"cor", "co"},
+	"Gal":    {"gal", "ga"},
+	"Eph":    {"eph", "ephes"},
+	"Phil":   {"phil", "php", "pp"},
+	"Col":    {"col"},
+	"1Thess": {"thess", "thes", "th"},
+	"2Thess": {"thess", "thes", "th"},
+	"1Tim":   {"tim", "ti"},
+	"2Tim":   {"tim", "ti"},
+	"Titus":  {"tit"},
+	"Phlm":   {"phlm", "philem", "phm"},
+	"Heb":    {"heb"},
+	"Jas":    {"jas", "jm"},
+	"1Pet":   {"pet", "pe", "pt"},
+	"2Pet":   {"pet", "pe", "pt"},
+	"1John":  {"jn", "jhn", "jo"},
+	"2John":  {"jn", "jhn", "jo"},
+	"3John":  {"jn", "jhn", "jo"},
+	"Jude":   {"jde"},
+	"Rev":    {"rev", "re"},
+}
+
+// bookAliases maps every normalized name, OSIS id and abbreviation to its book.
+var bookAliases = buildBookAliases()
+
+// maxBookWords is the most words in any book name, counting a number prefix.
+var maxBookWords = func() int {
+	most := 0
+	for alias := range bookAliases {
+		if n := len(strings.Fields(alias)); n > most {
+			most = n
+		}
+	}
+	return most
+}()
+
+func buildBookAliases() map[string]*Book {
+	aliases := make(map[string]*Book)
+	for i := range Books {
+		b := &Books[i]
+		aliases[normalizeBookName(b.Name)] = b
+		aliases[normalizeBookName(b.OSIS)] = b
+
+		prefix := ""
+		if b.Name[0] >= '1' && b.Name[0] <= '3' {
+			prefix = b.Name[:2]
+		}
+		for _, abbr := range bookAbbreviations[b.OSIS] {
+			aliases[prefix+abbr] = b
+		}
+	}
+	return aliases
+}
+
+// normalizeBookName lowercases a book name, drops abbreviation dots and puts a
+// single space between a leading number and the rest ("1Cor." becomes "1 cor").
+// A number written out or in roman numerals becomes a digit ("II Kings" is
+// "2 kings").
+func normalizeBookName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, ".", " "))
+	if len(name) > 1 && name[0] >= '1' && name[0] <= '3' && name[1] != ' ' {
+		name = name[:1] + " " + name[1:]
+	}
+	words := strings.Fields(name)
+	if len(words) > 1 {
+		if digit, ok := bookNumberPrefixes[words[0]]; ok {
+			words[0] = digit
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// LookupBook finds a book by canonical name, OSIS id or abbreviation, ignoring
+// case and abbreviation dots.
+func LookupBook(name string) (Book, bool) {
+	b := bookMatcher.exact(normalizeBookName(name))
+	if b == nil {
+		return Book{}, false
+	}
+	return *b, true
+}
+
+// BookByOrder returns the book at 1-based canonical position order.
+func BookByOrder(order int) (Book, bool) {
+	if order < 1 || order > len(Books) {
+		return Book{}, false
+	}
+	return Books[order-1], true
+}
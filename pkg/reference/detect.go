@@ -0,0 +1,197 @@
+package reference
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// HighConfidence is the confidence at or above which a detected reference is
+// trusted enough to take over from semantic search.
+const HighConfidence = 0.75
+
+// Detection is a reference found in free text.
+type Detection struct {
+	References []Reference
+	// Start and End are the byte offsets of the reference text in the query.
+	Start int
+	End   int
+	// Confidence estimates, from 0 to 1, how likely it is that the user meant a
+	// reference rather than ordinary words.
+	Confidence float64
+}
+
+// ambiguousBookWords are abbreviations and book names that are also everyday
+// words, so "I am 2 nights" or "job 3 months" are not read as Amos 2 or Job 3
+// without more evidence.
+var ambiguousBookWords = map[string]bool{
+	"am": true, "is": true, "so": true, "ex": true, "job": true, "acts": true,
+	"act": true, "mark": true, "numbers": true, "song": true, "pet": true,
+	"pro": true, "col": true, "hag": true, "lam": true, "tit": true, "gal": true,
+	"dan": true, "num": true, "mic": true, "jon": true, "be": true, "de": true,
+	"re": true, "ne": true, "na": true, "la": true, "ho": true, "es": true,
+	"ac": true, "co": true, "ch": true, "pe": true, "ti": true, "sa": true,
+	"jo": true, "ob": true, "da": true, "le": true, "ge": true, "pr": true,
+	"mr": true, "ru": true, "ki": true, "th": true, "nu": true, "rm": true,
+}
+
+// Detect looks for the most plausible reference in query. A reference must
+// start at a word boundary with its book name, and must end with a number.
+// It reports false when query contains no reference at all.
+func Detect(query string) (Detection, bool) {
+	tokens, _ := lex(query, true)
+
+	lastNumber := -1
+	for i, t := range tokens {
+		if t.kind == tokenNumber {
+			lastNumber = i
+		}
+	}
+
+	var best Detection
+	found := false
+	for s, start := range tokens {
+		if s >= lastNumber {
+			// No number left to end a reference.
+			break
+		}
+		if start.kind != tokenWord && !(start.kind == tokenNumber && startsBookAt(tokens, s)) {
+			continue
+		}
+		if s > 0 && tokens[s-1].end() == start.offset && tokens[s-1].kind != tokenOther {
+			// Not at a word boundary, e.g. the "1" in "John1".
+			continue
+		}
+		// Every span starting here starts with the same book name, so when
+		// that is no book, none of them is a reference.
+		if name, ok := bookText(tokens[s:]); !ok || len(strings.Fields(name)) > maxBookWords {
+			continue
+		} else if _, _, ok := MatchBook(name); !ok {
+			continue
+		}
+		// Longest parse wins for spans starting here.
+		for e := len(tokens); e > s; e-- {
+			if tokens[e-1].kind != tokenNumber {
+				continue
+			}
+			span := query[start.offset:tokens[e-1].end()]
+			refs, err := Parse(span)
+			var perr *ParseError
+			if errors.As(err, &perr) && perr.Offset == 0 {
+				// The book name failed, and so will every shorter span's.
+				break
+			}
+			if err != nil {
+				continue
+			}
+			d := Detection{References: refs, Start: start.offset, End: tokens[e-1].end()}
+			d.Confidence = confidence(query, tokens[s:e], d)
+			if !found || d.Confidence > best.Confidence {
+				best, found = d, true
+			}
+			break
+		}
+	}
+	return best, found
+}
+
+func startsBookAt(tokens []token, i int) bool {
+	p := parser{tokens: tokens, pos: i}
+	return p.startsBook()
+}
+
+func confidence(query string, span []token, d Detection) float64 {
+	whole := !hasWordOutside(query, d.Start, d.End)
+	verseLevel := false
+	for _, t := range span {
+		if t.kind == tokenSeparator {
+			verseLevel = true
+			break
+		}
+	}
+
+	var score float64
+	coverage := float64(d.End-d.Start) / float64(len(strings.TrimSpace(query)))
+	switch {
+	case whole && verseLevel:
+		score = 0.95
+	case whole:
+		score = 0.85
+	case verseLevel:
+		score = 0.7 + 0.3*coverage
+	default:
+		score = 0.3 + 0.3*coverage
+	}
+
+	// Penalize book names that double as ordinary words, less so when written
+	// capitalized or followed by a chapter:verse.
+	if word, ok := bookWord(span); ok && ambiguousBookWords[strings.ToLower(word)] {
+		penalty := 0.1
+		if unicode.IsLower([]rune(word)[0]) {
+			penalty = 0.3
+		}
+		if verseLevel {
+			penalty /= 2
+		}
+		score -= penalty
+	}
+	// A misspelt book name is a weaker signal than a real one.
+	if name, ok := bookText(span); ok {
+		if _, typos, _ := MatchBook(name); typos > 0 {
+			score -= 0.1 * float64(typos)
+		}
+	}
+
+	if score > 1 {
+		score = 1
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// bookWord returns the book name word of a single-word book, skipping any
+// number prefix. Multi-word names are never ambiguous.
+func bookWord(span []token) (string, bool) {
+	var words []string
+	for i, t := range span {
+		if t.kind != tokenWord && !(i == 0 && t.kind == tokenNumber) {
+			break
+		}
+		if t.kind == tokenWord {
+			words = append(words, t.text)
+		}
+	}
+	if len(words) == 1 {
+		return words[0], true
+	}
+	if len(words) == 2 {
+		if _, isPrefix := bookNumberPrefixes[strings.ToLower(words[0])]; isPrefix {
+			return words[1], true
+		}
+	}
+	return "", false
+}
+
+// bookText joins the words, and any number prefix, that name the book.
+func bookText(span []token) (string, bool) {
+	var parts []string
+	for i, t := range span {
+		if t.kind != tokenWord && !(i == 0 && t.kind == tokenNumber) {
+			break
+		}
+		parts = append(parts, t.text)
+	}
+	return strings.Join(parts, " "), len(parts) > 0
+}
+
+func hasWordOutside(query string, start int, end int) bool {
+	outside := query[:start] + " " + query[end:]
+	for _, r := range outside {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
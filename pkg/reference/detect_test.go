@@ -0,0 +1,22 @@
+package reference
+
+import "testing"
+
+func BenchmarkDetect(b *testing.B) {
+	queries := map[string]string{
+		"reference": "John 3:16",
+		"short":     "love your enemies",
+		"long": "I have been struggling with anxiety for 3 months since I lost my job and my " +
+			"family is far away, I pray every night for 2 hours but I still feel alone and " +
+			"afraid of what tomorrow brings, what does the bible say about trusting God " +
+			"when life falls apart and nothing makes sense anymore after 10 years",
+	}
+	for name, query := range queries {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Detect(query)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package reference
+
+// bookTrie indexes every normalized book alias by character, so exact lookups
+// walk the name once and fuzzy lookups can prune whole subtrees as soon as the
+// edit distance grows too large. It is built once at init and only read after.
+type bookTrie struct {
+	labels   []byte
+	children []*bookTrie
+	book     *Book
+}
+
+func (t *bookTrie) child(c byte) *bookTrie {
+	for i, l := range t.labels {
+		if l == c {
+			return t.children[i]
+		}
+	}
+	return nil
+}
+
+var bookMatcher = buildBookTrie(bookAliases)
+
+func buildBookTrie(aliases map[string]*Book) *bookTrie {
+	root := &bookTrie{}
+	for alias, b := range aliases {
+		node := root
+		for i := 0; i < len(alias); i++ {
+			next := node.child(alias[i])
+			if next == nil {
+				next = &bookTrie{}
+				node.labels = append(node.labels, alias[i])
+				node.children = append(node.children, next)
+			}
+			node = next
+		}
+		node.book = b
+	}
+	return root
+}
+
+// exact returns the book whose alias is exactly the normalized name.
+func (t *bookTrie) exact(name string) *Book {
+	node := t
+	for i := 0; i < len(name); i++ {
+		node = node.child(name[i])
+		if node == nil {
+			return nil
+		}
+	}
+	return node.book
+}
+
+// fuzzy returns the book whose alias is closest to the normalized name within
+// maxDist edits, and that distance. It returns nil when nothing is close
+// enough or when two different books are equally close.
+func (t *bookTrie) fuzzy(name string, maxDist int) (*Book, int) {
+	// rows[d] is the Levenshtein row for the trie node at depth d; a walk only
+	// ever needs the rows along its current path, so they are reused.
+	var rows [][]int
+	row := func(depth int) []int {
+		for len(rows) <= depth {
+			rows = append(rows, make([]int, len(name)+1))
+		}
+		return rows[depth]
+	}
+	first := row(0)
+	for i := range first {
+		first[i] = i
+	}
+
+	best, bestDist, tied := (*Book)(nil), maxDist+1, false
+	var walk func(node *bookTrie, depth int)
+	walk = func(node *bookTrie, depth int) {
+		prev := rows[depth]
+		if node.book != nil {
+			d := prev[len(name)]
+			switch {
+			case d < bestDist:
+				best, bestDist, tied = node.book, d, false
+			case d == bestDist && node.book != best:
+				tied = true
+			}
+		}
+		for j, child := range node.children {
+			c := node.labels[j]
+			cur := row(depth + 1)
+			prev = rows[depth]
+			cur[0] = prev[0] + 1
+			rowMin := cur[0]
+			for i := 1; i < len(cur); i++ {
+				cost := 1
+				if name[i-1] == c {
+					cost = 0
+				}
+				cur[i] = min3(cur[i-1]+1, prev[i]+1, prev[i-1]+cost)
+				if cur[i] < rowMin {
+					rowMin = cur[i]
+				}
+			}
+			if rowMin <= maxDist {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(t, 0)
+
+	if best == nil || tied {
+		return nil, 0
+	}
+	return best, bestDist
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// maxBookTypos is how many misspelt letters a book name of length n may have.
+// Short names get none, since "Jon" or "Am" are a typo away from too much.
+func maxBookTypos(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 5:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// MatchBook finds a book like LookupBook, but also tolerates a few typos in
+// longer names ("Phillipians", "Revelations"). It reports how many edits the
+// match needed; 0 means the name was an exact alias.
+func MatchBook(name string) (Book, int, bool) {
+	normalized := normalizeBookName(name)
+	if b := bookMatcher.exact(normalized); b != nil {
+		return *b, 0, true
+	}
+	b, dist := bookMatcher.fuzzy(normalized, maxBookTypos(len(normalized)))
+	if b == nil {
+		return Book{}, 0, false
+	}
+	return *b, dist, true
+}
@@ -0,0 +1,20 @@
+package reference
+
+import "testing"
+
+func BenchmarkMatchBook(b *testing.B) {
+	names := map[string]string{
+		"exact":   "1 Corinthians",
+		"alias":   "Jn",
+		"typo":    "Phillipians",
+		"unknown": "Nightmares",
+	}
+	for name, book := range names {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				MatchBook(book)
+			}
+		})
+	}
+}
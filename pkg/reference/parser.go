@@ -0,0 +1,346 @@
+package reference
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Grammar, over the tokens produced by lex:
+//
+//	references := reference { ";" ( reference | segments ) }
+//	reference  := book segments
+//	book       := [ prefix ] word { word }
+//	prefix     := "1" | "2" | "3" | "I" | "II" | "III" | "1st" | "first" | ...
+//	segments   := segment { "," segment }
+//	segment    := number [ sep number ] [ "-" number [ sep number ] ]
+//	sep        := ":" | "."
+//
+// A bare number is a chapter until a verse has been given, and a verse in the
+// current chapter after that, so "Rom 8:28, 31-39" lists two verse ranges in
+// chapter 8 while "Ps 1, 23" lists two chapters. In single-chapter books a bare
+// number is always a verse ("Jude 3").
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenWord
+	tokenSeparator
+	tokenDash
+	tokenComma
+	tokenSemicolon
+	// tokenOther is any other character, only produced when lexing leniently.
+	tokenOther
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+// end is the byte offset just past the token.
+func (t token) end() int {
+	return t.offset + len(t.text)
+}
+
+// lex splits input into tokens. Unexpected characters are an error unless
+// lenient is set, in which case they become tokenOther.
+func lex(input string, lenient bool) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	offsets := make([]int, len(runes)+1)
+	off := 0
+	for i, r := range runes {
+		offsets[i] = off
+		off += len(string(r))
+	}
+	offsets[len(runes)] = off
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			// Ordinal prefixes such as "1st" and "2nd" stay one word.
+			if i+1 < len(runes) && unicode.IsLetter(runes[i]) && unicode.IsLetter(runes[i+1]) {
+				suffix := strings.ToLower(string(runes[i : i+2]))
+				if suffix == "st" || suffix == "nd" || suffix == "rd" {
+					i += 2
+					tokens = append(tokens, token{tokenWord, string(runes[start:i]), offsets[start]})
+					continue
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), offsets[start]})
+		case unicode.IsLetter(r):
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '\'') {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[start:i]), offsets[start]})
+			// A dot straight after a word ends an abbreviation ("Rom.").
+			if i < len(runes) && runes[i] == '.' {
+				i++
+			}
+		case r == ':' || r == '.':
+			i++
+			// A trailing dot is punctuation, not a chapter/verse separator.
+			if r == '.' && (i >= len(runes) || !unicode.IsDigit(runes[i])) {
+				continue
+			}
+			tokens = append(tokens, token{tokenSeparator, string(r), offsets[start]})
+		case r == '-' || r == '–' || r == '—':
+			i++
+			tokens = append(tokens, token{tokenDash, string(r), offsets[start]})
+		case r == ',':
+			i++
+			tokens = append(tokens, token{tokenComma, ",", offsets[start]})
+		case r == ';':
+			i++
+			tokens = append(tokens, token{tokenSemicolon, ";", offsets[start]})
+		default:
+			i++
+			if lenient {
+				tokens = append(tokens, token{tokenOther, string(r), offsets[start]})
+				continue
+			}
+			return nil, &ParseError{Input: input, Offset: offsets[start], Msg: "unexpected character " + strconv.QuoteRune(r)}
+		}
+	}
+	return tokens, nil
+}
+
+// bookNumberPrefixes maps the ways a numbered book's number is written to the
+// digit used in canonical names.
+var bookNumberPrefixes = map[string]string{
+	"1": "1", "2": "2", "3": "3",
+	"i": "1", "ii": "2", "iii": "3",
+	"1st": "1", "2nd": "2", "3rd": "3",
+	"first": "1", "second": "2", "third": "3",
+}
+
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+// Parse parses one or more semicolon-separated references. Every token of the
+// input must belong to a reference.
+func Parse(input string) ([]Reference, error) {
+	tokens, err := lex(input, false)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: input, tokens: tokens}
+	if len(tokens) == 0 {
+		return nil, p.errorf("empty reference")
+	}
+	return p.parseReferences()
+}
+
+func (p *parser) peek(offset int) (token, bool) {
+	if p.pos+offset >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos+offset], true
+}
+
+func (p *parser) peekKind(kind tokenKind) bool {
+	t, ok := p.peek(0)
+	return ok && t.kind == kind
+}
+
+func (p *parser) errorf(msg string) error {
+	offset := len(p.input)
+	if t, ok := p.peek(0); ok {
+		offset = t.offset
+	}
+	return p.errorAt(offset, msg)
+}
+
+func (p *parser) errorAt(offset int, msg string) error {
+	return &ParseError{Input: p.input, Offset: offset, Msg: msg}
+}
+
+func (p *parser) parseReferences() ([]Reference, error) {
+	var refs []Reference
+	for {
+		var ref Reference
+		var err error
+		if len(refs) > 0 && p.peekKind(tokenNumber) && !p.startsBook() {
+			// "John 3:16; 4:2" continues in the previous book.
+			ref = Reference{Book: refs[len(refs)-1].Book}
+			ref.Ranges, err = p.parseSegments(ref.Book)
+		} else {
+			ref, err = p.parseReference()
+		}
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+
+		if !p.peekKind(tokenSemicolon) {
+			break
+		}
+		p.pos++
+		if _, ok := p.peek(0); !ok {
+			break
+		}
+	}
+	if _, ok := p.peek(0); ok {
+		return nil, p.errorf("unexpected " + strconv.Quote(p.tokens[p.pos].text))
+	}
+	return refs, nil
+}
+
+// startsBook reports whether the tokens at the current position begin a
+// numbered book name ("1 Cor") rather than a chapter number.
+func (p *parser) startsBook() bool {
+	t, ok := p.peek(0)
+	if !ok {
+		return false
+	}
+	next, ok := p.peek(1)
+	_, isPrefix := bookNumberPrefixes[strings.ToLower(t.text)]
+	return isPrefix && ok && next.kind == tokenWord
+}
+
+func (p *parser) parseReference() (Reference, error) {
+	book, err := p.parseBook()
+	if err != nil {
+		return Reference{}, err
+	}
+	ranges, err := p.parseSegments(book)
+	if err != nil {
+		return Reference{}, err
+	}
+	return Reference{Book: book, Ranges: ranges}, nil
+}
+
+func (p *parser) parseBook() (Book, error) {
+	start, ok := p.peek(0)
+	if !ok {
+		return Book{}, p.errorf("expected book name")
+	}
+	startPos := p.pos
+
+	prefix := ""
+	if p.startsBook() {
+		prefix = bookNumberPrefixes[strings.ToLower(start.text)] + " "
+		p.pos++
+	}
+
+	var words []string
+	for p.peekKind(tokenWord) {
+		words = append(words, p.tokens[p.pos].text)
+		p.pos++
+	}
+	if len(words) == 0 {
+		p.pos = startPos
+		return Book{}, p.errorf("expected book name")
+	}
+
+	name := prefix + strings.Join(words, " ")
+	book, _, ok := MatchBook(name)
+	if !ok {
+		return Book{}, p.errorAt(start.offset, "unknown book "+strconv.Quote(name))
+	}
+	return book, nil
+}
+
+func (p *parser) parseSegments(book Book) ([]Range, error) {
+	var ranges []Range
+	chapter := 0
+	inVerses := false
+	for {
+		rg, err := p.parseSegment(book, chapter, inVerses)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, rg)
+		chapter = rg.EndChapter
+		inVerses = !rg.IsWholeChapters()
+
+		if !p.peekKind(tokenComma) {
+			return ranges, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseSegment(book Book, chapter int, inVerses bool) (Range, error) {
+	start, _ := p.peek(0)
+	first, err := p.parseNumber("chapter")
+	if err != nil {
+		return Range{}, err
+	}
+
+	var rg Range
+	switch {
+	case p.peekKind(tokenSeparator):
+		p.pos++
+		verse, err := p.parseNumber("verse")
+		if err != nil {
+			return Range{}, err
+		}
+		rg = Range{StartChapter: first, StartVerse: verse}
+	case inVerses:
+		rg = Range{StartChapter: chapter, StartVerse: first}
+	case book.Chapters == 1:
+		rg = Range{StartChapter: 1, StartVerse: first}
+	default:
+		rg = Range{StartChapter: first}
+	}
+	rg.EndChapter, rg.EndVerse = rg.StartChapter, rg.StartVerse
+
+	if p.peekKind(tokenDash) {
+		p.pos++
+		end, err := p.parseNumber("range end")
+		if err != nil {
+			return Range{}, err
+		}
+		switch {
+		case p.peekKind(tokenSeparator):
+			p.pos++
+			endVerse, err := p.parseNumber("verse")
+			if err != nil {
+				return Range{}, err
+			}
+			if rg.StartVerse == 0 {
+				rg.StartVerse = 1
+			}
+			rg.EndChapter, rg.EndVerse = end, endVerse
+		case rg.IsWholeChapters():
+			rg.EndChapter = end
+		default:
+			rg.EndVerse = end
+		}
+	}
+
+	if rg.StartChapter > book.Chapters || rg.EndChapter > book.Chapters {
+		return Range{}, p.errorAt(start.offset, book.Name+" has only "+strconv.Itoa(book.Chapters)+" chapters")
+	}
+	if rg.EndChapter < rg.StartChapter || (rg.EndChapter == rg.StartChapter && rg.EndVerse < rg.StartVerse) {
+		return Range{}, p.errorAt(start.offset, "range ends before it starts")
+	}
+	return rg, nil
+}
+
+func (p *parser) parseNumber(what string) (int, error) {
+	t, ok := p.peek(0)
+	if !ok || t.kind != tokenNumber {
+		return 0, p.errorf("expected " + what + " number")
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 1 {
+		return 0, p.errorf("invalid " + what + " number " + strconv.Quote(t.text))
+	}
+	p.pos++
+	return n, nil
+}
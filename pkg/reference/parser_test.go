@@ -0,0 +1,73 @@
+package reference
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		canonical string
+		osis      string
+	}{
+		{"John 3:16", "John 3:16", "John.3.16"},
+		{"John 3:16-4:2", "John 3:16-4:2", "John.3.16-John.4.2"},
+		{"Rom 8:28, 31-39", "Romans 8:28, 31-39", "Rom.8.28 Rom.8.31-Rom.8.39"},
+		{"Ps 23; Isa 53", "Psalms 23; Isaiah 53", "Ps.23 Isa.53"},
+		{"Jn3.16", "John 3:16", "John.3.16"},
+		{"II Kings 2:11", "2 Kings 2:11", "2Kgs.2.11"},
+		{"1 Cor 13", "1 Corinthians 13", "1Cor.13"},
+		{"Jude 5", "Jude 1:5", "Jude.1.5"},
+	}
+	for _, tt := range tests {
+		refs, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := Format(refs); got != tt.canonical {
+			t.Errorf("Format(Parse(%q)) = %q, want %q", tt.input, got, tt.canonical)
+		}
+		if got := FormatOSIS(refs); got != tt.osis {
+			t.Errorf("FormatOSIS(Parse(%q)) = %q, want %q", tt.input, got, tt.osis)
+		}
+	}
+}
+
+// A book alone names no chapter, so it is not a reference, though the book
+// itself is recognised.
+func TestParseBookAlone(t *testing.T) {
+	book, ok := LookupBook("II Kings")
+	if !ok || book.Name != "2 Kings" || book.OSIS != "2Kgs" {
+		t.Errorf("LookupBook(%q) = %+v, %v, want 2 Kings (2Kgs)", "II Kings", book, ok)
+	}
+	var perr *ParseError
+	if _, err := Parse("II Kings"); !errors.As(err, &perr) {
+		t.Errorf("Parse(%q) error = %v, want a *ParseError", "II Kings", err)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"John 3:16", "John 3:16-4:2", "Rom 8:28, 31-39", "Ps 23; Isa 53", "Jn3.16",
+		"II Kings 2", "1 Cor 13", "Jude 5", "Song of Solomon 2:1-3", "Gen 1-3", "",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		refs, err := Parse(input)
+		if err != nil {
+			return
+		}
+		canonical := Format(refs)
+		again, err := Parse(canonical)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %q, which does not parse: %v", input, canonical, err)
+		}
+		if !reflect.DeepEqual(again, refs) {
+			t.Fatalf("Parse(%q) = %+v, but Parse(%q) = %+v", input, refs, canonical, again)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+// Package reference parses scripture references such as "John 3:16-4:2",
+// "Rom 8:28, 31-39" or "Ps 23; Isa 53" into structured form.
+package reference
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range is a contiguous span of scripture within one book. A range whose
+// StartVerse is 0 covers whole chapters, StartChapter through EndChapter.
+type Range struct {
+	StartChapter int
+	StartVerse   int
+	EndChapter   int
+	EndVerse     int
+}
+
+// IsWholeChapters reports whether the range covers whole chapters.
+func (r Range) IsWholeChapters() bool {
+	return r.StartVerse == 0
+}
+
+// IsSingleVerse reports whether the range covers exactly one verse.
+func (r Range) IsSingleVerse() bool {
+	return r.StartVerse != 0 && r.StartChapter == r.EndChapter && r.StartVerse == r.EndVerse
+}
+
+// CrossesChapters reports whether the range ends in a later chapter than it starts.
+func (r Range) CrossesChapters() bool {
+	return r.EndChapter != r.StartChapter
+}
+
+// Reference is one or more ranges within a single book.
+type Reference struct {
+	Book   Book
+	Ranges []Range
+}
+
+// String formats the reference canonically, e.g. "Romans 8:28, 31-39" or
+// "John 3:16-4:2". Verse-level ranges always include a chapter, so single
+// chapter books read "Jude 1:3".
+func (r Reference) String() string {
+	var b strings.Builder
+	b.WriteString(r.Book.Name)
+	b.WriteString(" ")
+
+	contextChapter := 0
+	for i, rg := range r.Ranges {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if rg.IsWholeChapters() {
+			b.WriteString(strconv.Itoa(rg.StartChapter))
+			if rg.EndChapter != rg.StartChapter {
+				b.WriteString("-" + strconv.Itoa(rg.EndChapter))
+			}
+			contextChapter = 0
+			continue
+		}
+
+		if rg.StartChapter != contextChapter {
+			b.WriteString(strconv.Itoa(rg.StartChapter) + ":")
+		}
+		b.WriteString(strconv.Itoa(rg.StartVerse))
+		if rg.CrossesChapters() {
+			b.WriteString(fmt.Sprintf("-%d:%d", rg.EndChapter, rg.EndVerse))
+		} else if rg.EndVerse != rg.StartVerse {
+			b.WriteString("-" + strconv.Itoa(rg.EndVerse))
+		}
+		contextChapter = rg.EndChapter
+	}
+	return b.String()
+}
+
+// OSIS formats the reference as space-separated OSIS references, e.g.
+// "Rom.8.28 Rom.8.31-Rom.8.39".
+func (r Reference) OSIS() string {
+	ids := make([]string, len(r.Ranges))
+	for i, rg := range r.Ranges {
+		start := r.osisPoint(rg.StartChapter, rg.StartVerse)
+		end := r.osisPoint(rg.EndChapter, rg.EndVerse)
+		if start == end {
+			ids[i] = start
+		} else {
+			ids[i] = start + "-" + end
+		}
+	}
+	return strings.Join(ids, " ")
+}
+
+func (r Reference) osisPoint(chapter int, verse int) string {
+	if verse == 0 {
+		return fmt.Sprintf("%s.%d", r.Book.OSIS, chapter)
+	}
+	return fmt.Sprintf("%s.%d.%d", r.Book.OSIS, chapter, verse)
+}
+
+// Format joins references canonically with "; ".
+func Format(refs []Reference) string {
+	parts := make([]string, len(refs))
+	for i, r := range refs {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// FormatOSIS joins the OSIS form of every reference with spaces.
+func FormatOSIS(refs []Reference) string {
+	parts := make([]string, len(refs))
+	for i, r := range refs {
+		parts[i] = r.OSIS()
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseError describes why, and where, an input is not a valid reference.
+type ParseError struct {
+	Input string
+	// Offset is the byte offset in Input where parsing failed.
+	Offset int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid reference %q: %s at offset %d", e.Input, e.Msg, e.Offset)
+}
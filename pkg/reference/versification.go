@@ -0,0 +1,163 @@
+package reference
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Versification records how a translation divides each book into chapters and
+// verses. Translations differ (Malachi has 3 chapters in some, 4 in others),
+// so one is built per loaded corpus. Lookups are O(1) and it is read-only once
+// built.
+type Versification struct {
+	// verseCounts[order-1][chapter-1] is the number of verses in a chapter.
+	verseCounts [][]int
+	// offsets[order-1][chapter-1] is the canonical position of its first verse.
+	offsets [][]int
+	total   int
+}
+
+// NewVersification builds a versification from verse counts per chapter,
+// keyed by any name LookupBook accepts.
+func NewVersification(verseCounts map[string][]int) (*Versification, error) {
+	counts := make([][]int, len(Books))
+	for name, chapters := range verseCounts {
+		b, ok := LookupBook(name)
+		if !ok {
+			return nil, fmt.Errorf("versification: unknown book %q", name)
+		}
+		for i, n := range chapters {
+			if n < 0 {
+				return nil, fmt.Errorf("versification: %s %d has %d verses", b.Name, i+1, n)
+			}
+		}
+		counts[b.Order-1] = chapters
+	}
+	return newVersification(counts), nil
+}
+
+func newVersification(counts [][]int) *Versification {
+	v := &Versification{verseCounts: counts, offsets: make([][]int, len(counts))}
+	for i, chapters := range counts {
+		v.offsets[i] = make([]int, len(chapters))
+		for j, n := range chapters {
+			v.offsets[i][j] = v.total
+			v.total += n
+		}
+	}
+	return v
+}
+
+// VersificationFromLocations derives a versification from verse locations such
+// as "John 3:16", taking the highest verse seen in each chapter. Locations
+// that are not single verses of a known book are ignored.
+func VersificationFromLocations(locations []string) *Versification {
+	counts := make([][]int, len(Books))
+	for _, loc := range locations {
+		b, chapter, verse, ok := SplitLocation(loc)
+		if !ok || verse == 0 {
+			continue
+		}
+		chapters := counts[b.Order-1]
+		for len(chapters) < chapter {
+			chapters = append(chapters, 0)
+		}
+		if verse > chapters[chapter-1] {
+			chapters[chapter-1] = verse
+		}
+		counts[b.Order-1] = chapters
+	}
+	return newVersification(counts)
+}
+
+// LoadVersification reads a versification from a JSON file mapping book names
+// to their verse counts per chapter, e.g. {"Jude": [25], "Obadiah": [21]}.
+func LoadVersification(file string) (*Versification, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var verseCounts map[string][]int
+	if err := json.Unmarshal(data, &verseCounts); err != nil {
+		return nil, fmt.Errorf("versification %s: %w", file, err)
+	}
+	return NewVersification(verseCounts)
+}
+
+// SplitLocation parses a canonical corpus location, "John 3" or "John 3:16",
+// into its book, chapter and verse. Verse is 0 for a chapter location.
+func SplitLocation(loc string) (book Book, chapter int, verse int, ok bool) {
+	space := strings.LastIndexByte(loc, ' ')
+	if space < 0 {
+		return Book{}, 0, 0, false
+	}
+	if book, ok = LookupBook(loc[:space]); !ok {
+		return Book{}, 0, 0, false
+	}
+
+	numbers := loc[space+1:]
+	if colon := strings.IndexByte(numbers, ':'); colon >= 0 {
+		if verse, _ = strconv.Atoi(numbers[colon+1:]); verse < 1 {
+			return Book{}, 0, 0, false
+		}
+		numbers = numbers[:colon]
+	}
+	if chapter, _ = strconv.Atoi(numbers); chapter < 1 {
+		return Book{}, 0, 0, false
+	}
+	return book, chapter, verse, true
+}
+
+// ChapterCount is the number of chapters of b in this versification.
+func (v *Versification) ChapterCount(b Book) int {
+	if b.Order < 1 || b.Order > len(v.verseCounts) {
+		return 0
+	}
+	return len(v.verseCounts[b.Order-1])
+}
+
+// VerseCount is the number of verses in a chapter of b, or 0 if it has no
+// such chapter.
+func (v *Versification) VerseCount(b Book, chapter int) int {
+	if chapter < 1 || chapter > v.ChapterCount(b) {
+		return 0
+	}
+	return v.verseCounts[b.Order-1][chapter-1]
+}
+
+// Position is the 0-based canonical position of a verse across the whole
+// Bible, so sorting by it orders verses canonically and consecutive verses
+// have consecutive positions. It reports false for verses that do not exist.
+func (v *Versification) Position(b Book, chapter int, verse int) (int, bool) {
+	if verse < 1 || verse > v.VerseCount(b, chapter) {
+		return 0, false
+	}
+	return v.offsets[b.Order-1][chapter-1] + verse - 1, true
+}
+
+// Len is the total number of verses.
+func (v *Versification) Len() int {
+	return v.total
+}
+
+// Validate checks that every chapter and verse ref names exists.
+func (v *Versification) Validate(ref Reference) error {
+	for _, rg := range ref.Ranges {
+		for _, point := range [][2]int{{rg.StartChapter, rg.StartVerse}, {rg.EndChapter, rg.EndVerse}} {
+			chapter, verse := point[0], point[1]
+			if v.ChapterCount(ref.Book) == 0 {
+				return fmt.Errorf("%s is not in this versification", ref.Book.Name)
+			}
+			if chapter > v.ChapterCount(ref.Book) {
+				return fmt.Errorf("%s has only %d chapters", ref.Book.Name, v.ChapterCount(ref.Book))
+			}
+			if verse > v.VerseCount(ref.Book, chapter) {
+				return fmt.Errorf("%s %d has only %d verses", ref.Book.Name, chapter, v.VerseCount(ref.Book, chapter))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package similarity
+
+import (
+	"errors"
+	"fmt"
+	"go-scripture/pkg/index"
+	"go-scripture/pkg/keyword"
+	"go-scripture/pkg/quote"
+	"go-scripture/pkg/reference"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Corpus holds everything loaded for searching one translation: the chapter
+// and verse embeddings, the verse text map, the versification, keyword and
+// quote indexes over the verse text, and optional ANN indexes over each. It is
+// shared by every request and must not be modified after load.
+type Corpus struct {
+	// Translation is the id the corpus is registered under, and VectorsFrom
+	// the translation whose embeddings it searches.
+	Translation   string
+	VectorsFrom   string
+	Chapters      []Embedding
+	Verses        []Embedding
+	VerseMap      map[string]string
+	Versification *reference.Versification
+	Keywords      *keyword.Index
+	Quotes        *quote.Index
+	ChapterIndex  *index.IVF
+	VerseIndex    *index.IVF
+}
+
+// NewCorpus builds a corpus whose versification is derived from the verses
+// it contains.
+func NewCorpus(embeddingsByChapter []Embedding, embeddingsByVerse []Embedding) *Corpus {
+	locations := make([]string, len(embeddingsByVerse))
+	for i, e := range embeddingsByVerse {
+		locations[i] = e.Location
+	}
+	return &Corpus{
+		Chapters:      embeddingsByChapter,
+		Verses:        embeddingsByVerse,
+		VerseMap:      BuildVerseMap(embeddingsByVerse),
+		Versification: reference.VersificationFromLocations(locations),
+		Keywords:      keyword.Build(textsOf(embeddingsByVerse)),
+		Quotes:        buildQuoteIndex(embeddingsByVerse),
+	}
+}
+
+// NewAlignedCorpus builds a corpus for a translation with no embeddings of its
+// own. Its verses, given without vectors, borrow the vectors of source's
+// verses at the same location, and its chapters those of source's chapters.
+// Verses source has no vector for can still be looked up but are not searched.
+// When every verse and chapter lines up, source's ANN indexes are shared.
+func NewAlignedCorpus(verses []Embedding, source *Corpus) *Corpus {
+	texts := make(map[string]string, len(verses))
+	chapterTexts := make(map[string][]string)
+	locations := make([]string, len(verses))
+	for i, e := range verses {
+		texts[e.Location] = e.Verse
+		locations[i] = e.Location
+		if colon := strings.LastIndexByte(e.Location, ':'); colon >= 0 {
+			chapter := e.Location[:colon]
+			chapterTexts[chapter] = append(chapterTexts[chapter], e.Verse)
+		}
+	}
+
+	var alignedVerses []Embedding
+	for _, e := range source.Verses {
+		if text, ok := texts[e.Location]; ok {
+			e.Verse = text
+			alignedVerses = append(alignedVerses, e)
+		}
+	}
+	var alignedChapters []Embedding
+	for _, e := range source.Chapters {
+		if parts, ok := chapterTexts[e.Location]; ok {
+			e.Verse = strings.Join(parts, " ")
+			alignedChapters = append(alignedChapters, e)
+		}
+	}
+
+	corpus := &Corpus{
+		VectorsFrom:   source.VectorsFrom,
+		Chapters:      alignedChapters,
+		Verses:        alignedVerses,
+		VerseMap:      BuildVerseMap(verses),
+		Versification: reference.VersificationFromLocations(locations),
+		Keywords:      keyword.Build(textsOf(alignedVerses)),
+		Quotes:        buildQuoteIndex(alignedVerses),
+	}
+	if len(alignedChapters) == len(source.Chapters) {
+		corpus.ChapterIndex = source.ChapterIndex
+	}
+	if len(alignedVerses) == len(source.Verses) {
+		corpus.VerseIndex = source.VerseIndex
+	}
+	return corpus
+}
+
+// LoadVersification replaces the derived versification with the one in file,
+// if it exists.
+func (c *Corpus) LoadVersification(file string) {
+	v, err := reference.LoadVersification(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error loading versification %s: %s\n", file, err)
+		return
+	}
+	fmt.Printf("Loaded versification %s\n", file)
+	c.Versification = v
+}
+
+// LoadOrBuildIndexes attaches IVF indexes for chapters and verses, reading them
+// from the given files or building (and saving) them when missing or stale.
+// Indexes already attached are kept.
+func (c *Corpus) LoadOrBuildIndexes(chapterIndexFile, verseIndexFile string) {
+	if c.ChapterIndex == nil {
+		c.ChapterIndex = loadOrBuildIndex(chapterIndexFile, c.Chapters)
+	}
+	if c.VerseIndex == nil {
+		c.VerseIndex = loadOrBuildIndex(verseIndexFile, c.Verses)
+	}
+}
+
+func loadOrBuildIndex(file string, embeddings []Embedding) *index.IVF {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	idx, err := index.LoadOrBuildIVF(file, vectorsOf(embeddings))
+	if err != nil {
+		fmt.Printf("Error saving ANN index %s: %s\n", file, err)
+	}
+	return idx
+}
+
+// VersificationPath is where a versification overriding the one derived from a
+// dataset file is looked for.
+func VersificationPath(datasetFile string) string {
+	return strings.TrimSuffix(datasetFile, filepath.Ext(datasetFile)) + ".versification.json"
+}
+
+// IndexPath is where the ANN index for a dataset file is stored.
+func IndexPath(datasetFile string) string {
+	return strings.TrimSuffix(datasetFile, filepath.Ext(datasetFile)) + ".ivf"
+}
+
+func textsOf(embeddings []Embedding) []string {
+	texts := make([]string, len(embeddings))
+	for i, e := range embeddings {
+		texts[i] = e.Verse
+	}
+	return texts
+}
+
+func vectorsOf(embeddings []Embedding) [][]float32 {
+	vectors := make([][]float32, len(embeddings))
+	for i, e := range embeddings {
+		vectors[i] = e.Embedding
+	}
+	return vectors
+}
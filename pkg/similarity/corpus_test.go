@@ -0,0 +1,56 @@
+package similarity
+
+import (
+	"context"
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"strings"
+	"testing"
+)
+
+// testChapters are the chapters of the test corpus and their verse counts,
+// chosen for orderings that sort differently as strings and across a book
+// boundary (Jude is one chapter, followed by Revelation).
+var testChapters = []struct {
+	book    string
+	chapter int
+	verses  int
+}{
+	{"Psalms", 1, 6},
+	{"Psalms", 10, 18},
+	{"Psalms", 100, 5},
+	{"John", 3, 36},
+	{"Jude", 1, 25},
+	{"Revelation", 1, 20},
+}
+
+const testDimension = 16
+
+// newTestCorpus builds a small corpus whose vectors come from a FakeEmbedder,
+// with the text of each verse its location.
+func newTestCorpus(t testing.TB) (*Corpus, embeddings.Embedder) {
+	t.Helper()
+	embedder := embeddings.NewFakeEmbedder(testDimension)
+	embed := func(text string) []float32 {
+		vector, err := embedder.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return embeddings.ToFloat32(vector)
+	}
+
+	var chapters, verses []Embedding
+	for _, c := range testChapters {
+		var texts []string
+		for v := 1; v <= c.verses; v++ {
+			location := fmt.Sprintf("%s %d:%d", c.book, c.chapter, v)
+			text := "text of " + location
+			texts = append(texts, text)
+			verses = append(verses, Embedding{Location: location, Verse: text, Embedding: embed(text), Index: len(verses)})
+		}
+		location := fmt.Sprintf("%s %d", c.book, c.chapter)
+		text := strings.Join(texts, " ")
+		chapters = append(chapters, Embedding{Location: location, Verse: text, Embedding: embed(text), Index: len(chapters)})
+	}
+	return NewCorpus(chapters, verses), embedder
+}
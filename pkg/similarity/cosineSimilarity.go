@@ -1,19 +1,24 @@
 package similarity
 
-import "math"
+import (
+	"fmt"
+	"go-scripture/pkg/embeddings"
+	"math"
+)
 
 // Functions: cosineSimilarity, findSimilarities, processPassageResults
-func cosineSimilarity(a []float64, b []float64) float64 {
+func cosineSimilarity(a []float32, b []float32) (float64, error) {
 	if len(a) != len(b) {
-		panic("vector lengths do not match")
+		return 0, fmt.Errorf("%w: %d and %d", embeddings.ErrDimensionMismatch, len(a), len(b))
 	}
 
 	var dotProduct, normA, normB float64
 	for i := range a {
-		dotProduct += a[i] * float64(b[i])
-		normA += a[i] * a[i]
-		normB += float64(b[i]) * float64(b[i])
+		x, y := float64(a[i]), float64(b[i])
+		dotProduct += x * y
+		normA += x * x
+		normB += y * y
 	}
 
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB)), nil
 }
@@ -0,0 +1,125 @@
+package similarity
+
+import "go-scripture/pkg/reference"
+
+// Diversity spreads out the results of a search, which for a topic often
+// crowd into one chapter or repeat each other across parallel accounts
+// (Kings and Chronicles, the synoptic Gospels). The zero Diversity ranks by
+// score alone.
+type Diversity struct {
+	// MMR re-ranks by maximal marginal relevance: each next result is the one
+	// with the most Lambda times its relevance, less 1-Lambda times its
+	// similarity to the closest result ranked before it.
+	MMR    bool
+	Lambda float64
+	// MaxPerBook and MaxPerChapter, when non-zero, cap the results from one
+	// book or one chapter.
+	MaxPerBook    int
+	MaxPerChapter int
+}
+
+// DefaultLambda leans towards relevance, letting redundancy break near ties.
+const DefaultLambda = 0.7
+
+// diversifyDepth is how many of the best results a diversified search
+// re-ranks, unless the page asked for reaches further.
+const diversifyDepth = 200
+
+// IsEmpty reports whether d leaves the ranking alone.
+func (d Diversity) IsEmpty() bool {
+	return !d.MMR && d.MaxPerBook == 0 && d.MaxPerChapter == 0
+}
+
+// depth is how many of the best results d re-ranks for a page ending at end.
+func (d Diversity) depth(end int) int {
+	if end > diversifyDepth {
+		return end
+	}
+	return diversifyDepth
+}
+
+// RankingDepth is how many of the best results a search with opts ranks to
+// fill its page.
+func RankingDepth(opts SearchOptions) int {
+	end := opts.Offset + opts.Limit
+	if opts.Diversity.IsEmpty() {
+		return end
+	}
+	return opts.Diversity.depth(end)
+}
+
+// diversify returns the order in which d ranks results, sorted by descending
+// Similarity, as indices into results. Results over a cap are left out.
+// Relevance is the Similarity min-max scaled to 0..1, so that it weighs the
+// same against redundancy whatever the scale of the scores; redundancy is the
+// cosine similarity of the stored embeddings, and results without one, such
+// as passages, are never redundant.
+func (d Diversity) diversify(results []Embedding) []int {
+	relevance := make([]float64, len(results))
+	if len(results) > 0 {
+		low, high := results[len(results)-1].Similarity, results[0].Similarity
+		for i, e := range results {
+			relevance[i] = 1
+			if high > low {
+				relevance[i] = (e.Similarity - low) / (high - low)
+			}
+		}
+	}
+
+	type chapterKey struct{ book, chapter int }
+	perBook := make(map[int]int)
+	perChapter := make(map[chapterKey]int)
+	redundancy := make([]float64, len(results))
+	done := make([]bool, len(results))
+	var order []int
+	for {
+		best, bestScore := -1, 0.0
+		for i := range results {
+			if done[i] {
+				continue
+			}
+			score := relevance[i]
+			if d.MMR {
+				score = d.Lambda*relevance[i] - (1-d.Lambda)*redundancy[i]
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			return order
+		}
+		done[best] = true
+
+		book, chapter, ok := bookAndChapter(results[best].Location)
+		if ok {
+			if (d.MaxPerBook > 0 && perBook[book] >= d.MaxPerBook) ||
+				(d.MaxPerChapter > 0 && perChapter[chapterKey{book, chapter}] >= d.MaxPerChapter) {
+				continue
+			}
+			perBook[book]++
+			perChapter[chapterKey{book, chapter}]++
+		}
+		order = append(order, best)
+
+		if d.MMR && len(results[best].Embedding) > 0 {
+			for i := range results {
+				if done[i] || len(results[i].Embedding) == 0 {
+					continue
+				}
+				if sim, err := cosineSimilarity(results[i].Embedding, results[best].Embedding); err == nil && sim > redundancy[i] {
+					redundancy[i] = sim
+				}
+			}
+		}
+	}
+}
+
+// bookAndChapter finds the book order and first chapter of a result location.
+func bookAndChapter(location string) (int, int, bool) {
+	refs, err := reference.Parse(location)
+	if err != nil || len(refs) == 0 || len(refs[0].Ranges) == 0 {
+		return 0, 0, false
+	}
+	return refs[0].Book.Order, refs[0].Ranges[0].StartChapter, true
+}
@@ -0,0 +1,99 @@
+package similarity
+
+import (
+	"reflect"
+	"testing"
+)
+
+// nearDuplicates are three results, best first, the second pointing almost
+// the same way as the first and the third elsewhere.
+func nearDuplicates() []Embedding {
+	return []Embedding{
+		{Location: "John 3:16", Similarity: 1.0, Embedding: []float32{1, 0, 0}},
+		{Location: "Psalms 1:1", Similarity: 0.95, Embedding: []float32{0.99, 0.01, 0}},
+		{Location: "Jude 1:24", Similarity: 0.9, Embedding: []float32{0, 1, 0}},
+	}
+}
+
+func TestDiversify(t *testing.T) {
+	tests := []struct {
+		name      string
+		diversity Diversity
+		want      []int
+	}{
+		{"score alone", Diversity{}, []int{0, 1, 2}},
+		{"lambda 1 is relevance alone", Diversity{MMR: true, Lambda: 1}, []int{0, 1, 2}},
+		{"default lambda", Diversity{MMR: true, Lambda: DefaultLambda}, []int{0, 1, 2}},
+		{"lower lambda demotes the near duplicate", Diversity{MMR: true, Lambda: 0.5}, []int{0, 2, 1}},
+		{"lambda 0 is redundancy alone", Diversity{MMR: true, Lambda: 0}, []int{0, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.diversity.diversify(nearDuplicates()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiversifyWithoutEmbeddings(t *testing.T) {
+	results := nearDuplicates()
+	for i := range results {
+		results[i].Embedding = nil
+	}
+	if got, want := (Diversity{MMR: true, Lambda: 0.5}).diversify(results), []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDiversityCapsAcrossPages(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	vector := corpus.Verses[0].Embedding
+	opts := SearchOptions{MinScore: -1, Limit: 2, Diversity: Diversity{MMR: true, Lambda: DefaultLambda, MaxPerBook: 3, MaxPerChapter: 2}}
+
+	var found []Embedding
+	for {
+		page, total, err := FindSimilarities("", LocationStruct{}, corpus, nil, "verse", vector, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// At most 3 from Psalms, and 2 from each of John 3, Jude 1 and Revelation 1.
+		if total != 9 {
+			t.Fatalf("total = %d, want 9", total)
+		}
+		if len(page) == 0 {
+			break
+		}
+		found = append(found, page...)
+		opts.Offset += opts.Limit
+	}
+	if len(found) != 9 {
+		t.Fatalf("got %d results across pages, want 9", len(found))
+	}
+
+	perBook := make(map[int]int)
+	perChapter := make(map[[2]int]int)
+	seen := make(map[string]bool)
+	for _, e := range found {
+		if seen[e.Location] {
+			t.Errorf("%s is on more than one page", e.Location)
+		}
+		seen[e.Location] = true
+		book, chapter, ok := bookAndChapter(e.Location)
+		if !ok {
+			t.Fatalf("cannot parse %q", e.Location)
+		}
+		perBook[book]++
+		perChapter[[2]int{book, chapter}]++
+	}
+	for book, n := range perBook {
+		if n > 3 {
+			t.Errorf("book %d has %d results, want at most 3", book, n)
+		}
+	}
+	for chapter, n := range perChapter {
+		if n > 2 {
+			t.Errorf("chapter %v has %d results, want at most 2", chapter, n)
+		}
+	}
+}
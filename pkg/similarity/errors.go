@@ -0,0 +1,18 @@
+package similarity
+
+import "errors"
+
+// Errors returned by searches are wrapped around these, or around the errors of
+// the embeddings package, so callers can tell them apart with errors.Is.
+var (
+	// ErrEmptyCorpus means there is nothing to search: the corpus has no
+	// embeddings of the kind asked for.
+	ErrEmptyCorpus = errors.New("corpus has no embeddings to search")
+	// ErrInvalidReference means a reference could not be understood.
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrReferenceNotFound means a reference names a chapter or verse the
+	// translation does not have.
+	ErrReferenceNotFound = errors.New("reference not found")
+	// ErrBeyondIndex means a page starts past the results an ANN search ranks.
+	ErrBeyondIndex = errors.New("offset beyond the results of the ANN index")
+)
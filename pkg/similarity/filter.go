@@ -0,0 +1,374 @@
+package similarity
+
+import (
+	"fmt"
+	"go-scripture/pkg/keyword"
+	"go-scripture/pkg/reference"
+	"strings"
+)
+
+// Filter restricts the verses or chapters a search scores. The zero Filter
+// allows everything.
+type Filter struct {
+	// Books, when non-empty, holds the reference.Book.Order of every book
+	// allowed.
+	Books map[int]bool
+	// Testament, when set, is the only testament allowed.
+	Testament reference.Testament
+	// Chapter, when non-zero, is the only chapter allowed in each book.
+	Chapter int
+	// Phrases must all appear in the text, and none of Excluded may. Both are
+	// compared after keyword.Tokenize, so "loved" also matches "loveth".
+	Phrases  []string
+	Excluded []string
+	// From and To, when set, bound the canonical range allowed, inclusively.
+	From *Bound
+	To   *Bound
+	// ExcludedRefs are passages never allowed.
+	ExcludedRefs []reference.Reference
+	// none is set by And when two filters cannot both hold.
+	none bool
+}
+
+// Bound is a point in canonical order. A zero Chapter or Verse stands for the
+// whole book or chapter, so a From of "Matthew" starts at Matthew 1:1 and a To
+// of "John 3" ends at the last verse of John 3.
+type Bound struct {
+	Book    int
+	Chapter int
+	Verse   int
+}
+
+// IsEmpty reports whether f allows everything.
+func (f Filter) IsEmpty() bool {
+	return len(f.Books) == 0 && f.Testament == "" && f.Chapter == 0 &&
+		len(f.Phrases) == 0 && len(f.Excluded) == 0 &&
+		f.From == nil && f.To == nil && len(f.ExcludedRefs) == 0 && !f.none
+}
+
+// And returns a filter allowing only what both f and g allow.
+func (f Filter) And(g Filter) Filter {
+	and := f
+	and.none = f.none || g.none
+	switch {
+	case len(f.Books) == 0:
+		and.Books = g.Books
+	case len(g.Books) > 0:
+		and.Books = make(map[int]bool)
+		for order := range f.Books {
+			if g.Books[order] {
+				and.Books[order] = true
+			}
+		}
+		and.none = and.none || len(and.Books) == 0
+	}
+	if g.Testament != "" {
+		and.none = and.none || (f.Testament != "" && f.Testament != g.Testament)
+		and.Testament = g.Testament
+	}
+	if g.Chapter != 0 {
+		and.none = and.none || (f.Chapter != 0 && f.Chapter != g.Chapter)
+		and.Chapter = g.Chapter
+	}
+	if g.From != nil && (f.From == nil || compareBounds(*g.From, *f.From) > 0) {
+		and.From = g.From
+	}
+	if g.To != nil && (f.To == nil || compareBounds(*g.To, *f.To) < 0) {
+		and.To = g.To
+	}
+	and.Phrases = append(append([]string(nil), f.Phrases...), g.Phrases...)
+	and.Excluded = append(append([]string(nil), f.Excluded...), g.Excluded...)
+	and.ExcludedRefs = append(append([]reference.Reference(nil), f.ExcludedRefs...), g.ExcludedRefs...)
+	return and
+}
+
+// SetBooks allows only the books listed, comma separated, each a book name or
+// a range of books in canonical order such as "Romans-Jude".
+func (f *Filter) SetBooks(list string) error {
+	books := make(map[int]bool)
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			last = first
+		}
+		start, err := lookupFilterBook(first)
+		if err != nil {
+			return err
+		}
+		end, err := lookupFilterBook(last)
+		if err != nil {
+			return err
+		}
+		if end.Order < start.Order {
+			return fmt.Errorf("%s comes after %s", start.Name, end.Name)
+		}
+		for order := start.Order; order <= end.Order; order++ {
+			books[order] = true
+		}
+	}
+	*f = f.And(Filter{Books: books})
+	return nil
+}
+
+// SetTestament allows only the Old ("OT") or New ("NT") Testament.
+func (f *Filter) SetTestament(testament string) error {
+	switch strings.ToUpper(testament) {
+	case "OT", "OLD":
+		*f = f.And(Filter{Testament: reference.OldTestament})
+	case "NT", "NEW":
+		*f = f.And(Filter{Testament: reference.NewTestament})
+	default:
+		return fmt.Errorf("testament must be OT or NT")
+	}
+	return nil
+}
+
+// SetFrom allows only what comes at or after the start of a reference, which
+// may be just a book.
+func (f *Filter) SetFrom(ref string) error {
+	r, err := parseFilterReference(ref)
+	if err != nil {
+		return err
+	}
+	rg := r.Ranges[0]
+	*f = f.And(Filter{From: &Bound{Book: r.Book.Order, Chapter: rg.StartChapter, Verse: rg.StartVerse}})
+	return nil
+}
+
+// SetTo allows only what comes at or before the end of a reference, which may
+// be just a book.
+func (f *Filter) SetTo(ref string) error {
+	r, err := parseFilterReference(ref)
+	if err != nil {
+		return err
+	}
+	rg := r.Ranges[len(r.Ranges)-1]
+	*f = f.And(Filter{To: &Bound{Book: r.Book.Order, Chapter: rg.EndChapter, Verse: rg.EndVerse}})
+	return nil
+}
+
+// SetExcluded never allows the references listed, comma separated, each a
+// book, chapter, verse or range.
+func (f *Filter) SetExcluded(list string) error {
+	var refs []reference.Reference
+	for _, item := range strings.Split(list, ",") {
+		r, err := parseFilterReference(item)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, r)
+	}
+	*f = f.And(Filter{ExcludedRefs: refs})
+	return nil
+}
+
+// parseFilterReference parses a single reference, taking a bare book name as
+// the whole book.
+func parseFilterReference(ref string) (reference.Reference, error) {
+	ref = strings.TrimSpace(ref)
+	if book, ok := reference.LookupBook(ref); ok {
+		return reference.Reference{Book: book, Ranges: []reference.Range{{StartChapter: 1, EndChapter: book.Chapters}}}, nil
+	}
+	refs, err := reference.Parse(ref)
+	if err != nil || len(refs) != 1 {
+		return reference.Reference{}, fmt.Errorf("%w %q", ErrInvalidReference, ref)
+	}
+	return refs[0], nil
+}
+
+func lookupFilterBook(name string) (reference.Book, error) {
+	book, ok := reference.LookupBook(strings.ReplaceAll(strings.TrimSpace(name), "_", " "))
+	if !ok {
+		return reference.Book{}, fmt.Errorf("unknown book %q", name)
+	}
+	return book, nil
+}
+
+// candidates returns the positions in embeddings that f allows, or nil when f
+// is empty and every position is allowed. versification tells which verses
+// make up a whole chapter.
+func (f Filter) candidates(embeddings []Embedding, versification *reference.Versification) []int {
+	if f.IsEmpty() {
+		return nil
+	}
+	cf := f.compile(versification)
+	allowed := []int{}
+	for i, e := range embeddings {
+		if cf.allows(e) {
+			allowed = append(allowed, i)
+		}
+	}
+	return allowed
+}
+
+// compiledFilter is a Filter with its phrases tokenized once per search, and
+// the versification of the corpus searched.
+type compiledFilter struct {
+	Filter
+	versification *reference.Versification
+	phrases       [][]string
+	excluded      [][]string
+}
+
+func (f Filter) compile(versification *reference.Versification) compiledFilter {
+	return compiledFilter{Filter: f, versification: versification, phrases: tokenizeAll(f.Phrases), excluded: tokenizeAll(f.Excluded)}
+}
+
+func (cf compiledFilter) allows(e Embedding) bool {
+	if !cf.allowsLocation(e.Location) {
+		return false
+	}
+	if len(cf.phrases) == 0 && len(cf.excluded) == 0 {
+		return true
+	}
+	terms := keyword.Tokenize(e.Verse)
+	return containsAll(terms, cf.phrases) && !containsAny(terms, cf.excluded)
+}
+
+func (cf compiledFilter) allowsLocation(location string) bool {
+	f := cf.Filter
+	if f.none {
+		return false
+	}
+	if len(f.Books) == 0 && f.Testament == "" && f.Chapter == 0 &&
+		f.From == nil && f.To == nil && len(f.ExcludedRefs) == 0 {
+		return true
+	}
+	book, chapter, verse, ok := reference.SplitLocation(location)
+	if !ok {
+		return false
+	}
+	if len(f.Books) > 0 && !f.Books[book.Order] {
+		return false
+	}
+	if f.Testament != "" && book.Testament != f.Testament {
+		return false
+	}
+	if f.Chapter != 0 && chapter != f.Chapter {
+		return false
+	}
+	at := Bound{Book: book.Order, Chapter: chapter, Verse: verse}
+	if (f.From != nil && compareBounds(at, *f.From) < 0) || (f.To != nil && compareBounds(at, *f.To) > 0) {
+		return false
+	}
+	for _, ref := range f.ExcludedRefs {
+		if excludes(ref, at, cf.versification) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareBounds orders two points canonically. A zero chapter or verse on
+// either side matches any, so a chapter overlapping a bound is within it.
+func compareBounds(a, b Bound) int {
+	switch {
+	case a.Book != b.Book:
+		return a.Book - b.Book
+	case a.Chapter == 0 || b.Chapter == 0:
+		return 0
+	case a.Chapter != b.Chapter:
+		return a.Chapter - b.Chapter
+	case a.Verse == 0 || b.Verse == 0:
+		return 0
+	}
+	return a.Verse - b.Verse
+}
+
+// excludes reports whether ref covers at. A chapter (Verse 0) is only covered
+// by a reference taking in the whole of it, from its first verse to its last
+// in versification.
+func excludes(ref reference.Reference, at Bound, versification *reference.Versification) bool {
+	if ref.Book.Order != at.Book {
+		return false
+	}
+	for _, rg := range ref.Ranges {
+		switch {
+		case rg.IsWholeChapters():
+			if at.Chapter >= rg.StartChapter && at.Chapter <= rg.EndChapter {
+				return true
+			}
+		case at.Verse == 0:
+			if at.Chapter > rg.StartChapter && at.Chapter < rg.EndChapter {
+				return true
+			}
+			last := versification.VerseCount(ref.Book, at.Chapter)
+			if last == 0 {
+				continue
+			}
+			start := Bound{Book: at.Book, Chapter: rg.StartChapter, Verse: rg.StartVerse}
+			end := Bound{Book: at.Book, Chapter: rg.EndChapter, Verse: rg.EndVerse}
+			if compareBounds(Bound{Book: at.Book, Chapter: at.Chapter, Verse: 1}, start) >= 0 &&
+				compareBounds(Bound{Book: at.Book, Chapter: at.Chapter, Verse: last}, end) <= 0 {
+				return true
+			}
+		default:
+			start := Bound{Book: at.Book, Chapter: rg.StartChapter, Verse: rg.StartVerse}
+			end := Bound{Book: at.Book, Chapter: rg.EndChapter, Verse: rg.EndVerse}
+			if compareBounds(at, start) >= 0 && compareBounds(at, end) <= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterMatches keeps the matches whose position is in allowed.
+func filterMatches(matches []Match, allowed []int) []Match {
+	keep := make(map[int]bool, len(allowed))
+	for _, i := range allowed {
+		keep[i] = true
+	}
+	kept := matches[:0:0]
+	for _, m := range matches {
+		if keep[m.Index] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func tokenizeAll(phrases []string) [][]string {
+	var tokenized [][]string
+	for _, p := range phrases {
+		if terms := keyword.Tokenize(p); len(terms) > 0 {
+			tokenized = append(tokenized, terms)
+		}
+	}
+	return tokenized
+}
+
+func containsAll(terms []string, phrases [][]string) bool {
+	for _, p := range phrases {
+		if !containsPhrase(terms, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(terms []string, phrases [][]string) bool {
+	for _, p := range phrases {
+		if containsPhrase(terms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPhrase reports whether phrase occurs as consecutive terms.
+func containsPhrase(terms []string, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(terms); i++ {
+		match := true
+		for j, p := range phrase {
+			if terms[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package similarity
+
+import "testing"
+
+func TestCompareBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Bound
+		want int
+	}{
+		{"earlier book", Bound{43, 3, 16}, Bound{44, 1, 1}, -1},
+		{"later chapter", Bound{43, 4, 1}, Bound{43, 3, 36}, 1},
+		{"earlier verse", Bound{43, 3, 15}, Bound{43, 3, 16}, -1},
+		{"same verse", Bound{43, 3, 16}, Bound{43, 3, 16}, 0},
+		{"whole book", Bound{43, 0, 0}, Bound{43, 3, 16}, 0},
+		{"whole chapter", Bound{43, 3, 0}, Bound{43, 3, 16}, 0},
+		{"whole chapter in an earlier chapter", Bound{43, 2, 0}, Bound{43, 3, 16}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareBounds(tt.a, tt.b)
+			if sign(got) != tt.want {
+				t.Errorf("compareBounds(%v, %v) = %d, want sign %d", tt.a, tt.b, got, tt.want)
+			}
+			if back := compareBounds(tt.b, tt.a); sign(back) != -tt.want {
+				t.Errorf("compareBounds(%v, %v) = %d, want sign %d", tt.b, tt.a, back, -tt.want)
+			}
+		})
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestFilterScopes(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	tests := []struct {
+		name    string
+		set     func(*Filter) error
+		allowed []string
+		blocked []string
+	}{
+		{
+			name:    "from a verse",
+			set:     func(f *Filter) error { return f.SetFrom("John 3:16") },
+			allowed: []string{"John 3:16", "John 3", "Jude 1:1", "Revelation 1"},
+			blocked: []string{"John 3:15", "Psalms 100:5", "Psalms 100"},
+		},
+		{
+			name:    "from a book",
+			set:     func(f *Filter) error { return f.SetFrom("Jude") },
+			allowed: []string{"Jude 1:1", "Jude 1", "Revelation 1:1"},
+			blocked: []string{"John 3:36", "John 3"},
+		},
+		{
+			name:    "to a chapter",
+			set:     func(f *Filter) error { return f.SetTo("Psalms 10") },
+			allowed: []string{"Psalms 1:1", "Psalms 10:18", "Psalms 10"},
+			blocked: []string{"Psalms 100:1", "John 3:1"},
+		},
+		{
+			name:    "to a verse",
+			set:     func(f *Filter) error { return f.SetTo("John 3:16") },
+			allowed: []string{"John 3:16", "John 3", "Psalms 100:5"},
+			blocked: []string{"John 3:17", "Jude 1"},
+		},
+		{
+			name: "from and to",
+			set: func(f *Filter) error {
+				if err := f.SetFrom("Psalms 10"); err != nil {
+					return err
+				}
+				return f.SetTo("John 3:5")
+			},
+			allowed: []string{"Psalms 10:1", "Psalms 100", "John 3:5", "John 3"},
+			blocked: []string{"Psalms 1:6", "John 3:6", "Jude 1"},
+		},
+		{
+			name:    "exclude a verse range covering a whole chapter",
+			set:     func(f *Filter) error { return f.SetExcluded("John 3:1-36") },
+			allowed: []string{"Psalms 1", "Jude 1"},
+			blocked: []string{"John 3", "John 3:1", "John 3:36"},
+		},
+		{
+			name:    "exclude a verse range covering part of a chapter",
+			set:     func(f *Filter) error { return f.SetExcluded("John 3:1-35") },
+			allowed: []string{"John 3", "John 3:36"},
+			blocked: []string{"John 3:1", "John 3:35"},
+		},
+		{
+			name:    "exclude a range across chapters",
+			set:     func(f *Filter) error { return f.SetExcluded("Psalms 1:2-10:18") },
+			allowed: []string{"Psalms 1", "Psalms 1:1", "Psalms 100"},
+			blocked: []string{"Psalms 1:2", "Psalms 10", "Psalms 10:18"},
+		},
+		{
+			name:    "exclude whole chapters",
+			set:     func(f *Filter) error { return f.SetExcluded("Psalms 10-100") },
+			allowed: []string{"Psalms 1", "Psalms 1:6"},
+			blocked: []string{"Psalms 10", "Psalms 10:1", "Psalms 100:5"},
+		},
+		{
+			name:    "exclude a chapter and a book",
+			set:     func(f *Filter) error { return f.SetExcluded("John 3, Jude") },
+			allowed: []string{"Psalms 1:1", "Revelation 1"},
+			blocked: []string{"John 3", "John 3:16", "Jude 1", "Jude 1:25"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f Filter
+			if err := tt.set(&f); err != nil {
+				t.Fatal(err)
+			}
+			cf := f.compile(corpus.Versification)
+			for _, location := range tt.allowed {
+				if !cf.allowsLocation(location) {
+					t.Errorf("%s is blocked, want allowed", location)
+				}
+			}
+			for _, location := range tt.blocked {
+				if cf.allowsLocation(location) {
+					t.Errorf("%s is allowed, want blocked", location)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterScopeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(*Filter) error
+	}{
+		{"from an unknown book", func(f *Filter) error { return f.SetFrom("Nowhere 3") }},
+		{"to garbage", func(f *Filter) error { return f.SetTo("3:16") }},
+		{"exclude a bad item", func(f *Filter) error { return f.SetExcluded("John 3:16, bogus") }},
+		{"books out of order", func(f *Filter) error { return f.SetBooks("Jude-Romans") }},
+		{"unknown testament", func(f *Filter) error { return f.SetTestament("XT") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.set(&Filter{}); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestFilterAnd(t *testing.T) {
+	var f Filter
+	if err := f.SetFrom("Psalms 10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetFrom("John 3"); err != nil {
+		t.Fatal(err)
+	}
+	if f.From.Book != 43 || f.From.Chapter != 3 {
+		t.Errorf("From = %+v, want the later bound, John 3", *f.From)
+	}
+
+	if err := f.SetTestament("OT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetTestament("NT"); err != nil {
+		t.Fatal(err)
+	}
+	if f.compile(nil).allowsLocation("John 3:16") {
+		t.Error("OT and NT together allowed John 3:16")
+	}
+}
@@ -4,13 +4,8 @@ import (
 	"context"
 	"fmt"
 	"go-scripture/pkg/embeddings"
-	"os"
-	"sort"
-	"strings"
+	"go-scripture/pkg/index"
 	"sync"
-
-	"github.com/joho/godotenv"
-	"github.com/sashabaranov/go-openai"
 )
 
 type Embedding = embeddings.Embedding
@@ -21,113 +16,209 @@ type LocationStruct struct {
 	Book           string
 	Chapter        int
 	Verse          int
-	VerseEnd       int
+	// ChapterEnd and VerseEnd end a passage; VerseEnd is 0 for a single verse.
+	ChapterEnd int
+	VerseEnd   int
+	Confidence float64
 }
-type Tuple struct {
-	First  int
-	Second float64
+
+// Match is one scored entry of a per-request result set: the position of an
+// embedding in the corpus slice that was searched, and its similarity. Scoring
+// only ever produces new Matches; the corpus itself is read-only after load.
+type Match struct {
+	Index      int
+	Similarity float64
 }
 
-func FindSimilarities(query string, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string, searchBy string, searchTermVector []float64) []Embedding {
-	bibleEmbeddings := embeddingsByVerse
+// IndexDepth is how many results an ANN search ranks, whatever the page asked
+// for, so that its total does not change from page to page. Offsets past it
+// are an ErrBeyondIndex.
+const IndexDepth = 1000
+
+// FindSimilarities ranks the chapter or verse embeddings of corpus against query,
+// whose reference if any is loc (see DetectLocation), and returns copies of the
+// requested page of them carrying this request's scores, plus the number of
+// results meeting opts.MinScore. When the search is Approximate only the
+// index's best IndexDepth candidates are scored, and the number is of those;
+// passage searches always score every verse. A non-empty opts.Filter narrows
+// the embeddings scored before any scoring, bypassing the ANN index.
+func FindSimilarities(query string, loc LocationStruct, corpus *Corpus, embedder embeddings.Embedder, searchBy string, searchTermVector []float32, opts SearchOptions) ([]Embedding, int, error) {
+	bibleEmbeddings, searchIndex := corpus.Verses, corpus.VerseIndex
 	if searchBy == "chapter" {
-		bibleEmbeddings = embeddingsByChapter
+		bibleEmbeddings, searchIndex = corpus.Chapters, corpus.ChapterIndex
 	}
-	loc := checkIfLocation(query)
+	if len(bibleEmbeddings) == 0 {
+		return nil, 0, fmt.Errorf("%w: no %s embeddings in %s", ErrEmptyCorpus, searchBy, corpus.Translation)
+	}
+	var err error
 	if len(searchTermVector) == 0 {
-		searchTermVector = IfSearchNotExists(query, embeddingsByChapter, embeddingsByVerse, verseMap)
+		if searchTermVector, err = IfSearchNotExists(query, loc, corpus, embedder); err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(searchTermVector) != len(bibleEmbeddings[0].Embedding) {
+		return nil, 0, fmt.Errorf("%w: query has %d dimensions, %s embeddings have %d", embeddings.ErrDimensionMismatch, len(searchTermVector), corpus.Translation, len(bibleEmbeddings[0].Embedding))
+	}
+
+	k := 0
+	if opts.Limit > 0 {
+		k = opts.Offset + opts.Limit
+	}
+	if !opts.Diversity.IsEmpty() {
+		k = opts.Diversity.depth(k)
+	}
+
+	allowed := opts.Filter.candidates(bibleEmbeddings, corpus.Versification)
+
+	var matches []Match
+	if corpus.Approximate(searchBy, opts) {
+		if opts.Offset >= IndexDepth {
+			return nil, 0, fmt.Errorf("%w: offset %d, the index ranks %d results", ErrBeyondIndex, opts.Offset, IndexDepth)
+		}
+		matches = searchEmbeddingIndex(searchIndex, searchTermVector, IndexDepth)
+	} else if matches, err = calculateEmbeddingSimilarity(bibleEmbeddings, allowed, searchTermVector); err != nil {
+		return nil, 0, err
+	}
+	if opts.Mode == ModeHybrid && searchBy == "verse" {
+		keywords := keywordMatches(query, corpus)
+		if allowed != nil {
+			keywords = filterMatches(keywords, allowed)
+		}
+		matches = fuseMatches(matches, keywords, opts.Fusion, opts.Alpha)
 	}
-	similartyResults := calculateEmbeddingSimilarity(bibleEmbeddings, searchTermVector)
 	if loc.HasLocation {
-		updateExactMatchSimilarity(searchBy, loc, &similartyResults)
+		updateExactMatchSimilarity(loc, bibleEmbeddings, matches)
+	}
+
+	top, total := selectTopMatches(matches, k, opts.MinScore)
+	if !opts.Diversity.IsEmpty() {
+		page, total := Paginate(materializeMatches(bibleEmbeddings, top), opts)
+		return page, total, nil
+	}
+	if opts.Offset >= len(top) {
+		return []Embedding{}, total, nil
 	}
-	sort.Slice(similartyResults, func(i, j int) bool {
-		return similartyResults[i].Similarity > similartyResults[j].Similarity
-	})
+	return materializeMatches(bibleEmbeddings, top[opts.Offset:]), total, nil
+}
 
-	return similartyResults
+// Approximate reports whether FindSimilarities ranks a searchBy search with
+// opts from the ANN index alone, counting only the candidates it returns.
+func (c *Corpus) Approximate(searchBy string, opts SearchOptions) bool {
+	searchIndex := c.VerseIndex
+	if searchBy == "chapter" {
+		searchIndex = c.ChapterIndex
+	}
+	return opts.UseIndex && searchIndex != nil && searchBy != "passage" && opts.Filter.IsEmpty()
 }
 
-func IfSearchNotExists(query string, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) []float64 {
-	loc := checkIfLocation(strings.TrimSpace(query))
+func IfSearchNotExists(query string, loc LocationStruct, corpus *Corpus, embedder embeddings.Embedder) ([]float32, error) {
 	if loc.HasLocation {
-		query = SwapQueryForPassage(query, loc, verseMap)
+		query = SwapQueryForPassage(query, loc, corpus)
 		fmt.Println("Query swapped for passage")
 	}
-	return getSearchVector(query, loc, embeddingsByChapter, embeddingsByVerse, verseMap)
+	return getSearchVector(query, loc, corpus, embedder)
 
 }
 
-func calculateEmbeddingSimilarity(embeddings []Embedding, searchTermVector []float64) []Embedding {
+// searchEmbeddingIndex returns the index's best k candidates, probing more
+// lists when the default ones hold fewer than k vectors.
+func searchEmbeddingIndex(searchIndex *index.IVF, searchTermVector []float32, k int) []Match {
+	hits := searchIndex.Search(searchTermVector, k, 0)
+	for nprobe := searchIndex.NProbe; len(hits) < k && nprobe < searchIndex.NList(); {
+		nprobe = 2*nprobe + 1
+		hits = searchIndex.Search(searchTermVector, k, nprobe)
+	}
+	matches := make([]Match, len(hits))
+	for i, hit := range hits {
+		matches[i] = Match{Index: hit.ID, Similarity: hit.Score}
+	}
+	return matches
+}
+
+// calculateEmbeddingSimilarity scores the embeddings at positions candidates,
+// or every embedding when candidates is nil. It fails if any of them differs in
+// dimension from searchTermVector.
+func calculateEmbeddingSimilarity(embeddings []Embedding, candidates []int, searchTermVector []float32) ([]Match, error) {
+	if candidates == nil {
+		candidates = make([]int, len(embeddings))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
 	numWorkers := 8
-	jobs := make(chan int, len(embeddings))
-	results := make(chan Embedding, len(embeddings))
+	matches := make([]Match, len(candidates))
+	errs := make([]error, numWorkers)
+	jobs := make(chan int, len(candidates))
 	var wg sync.WaitGroup
 	for w := 0; w < numWorkers; w++ {
 		wg.Add(1)
-		go func() {
+		go func(w int) {
 			for i := range jobs {
-				embeddings[i].Similarity = cosineSimilarity(embeddings[i].Embedding, searchTermVector)
-				results <- embeddings[i]
+				id := candidates[i]
+				similarity, err := cosineSimilarity(embeddings[id].Embedding, searchTermVector)
+				if err != nil && errs[w] == nil {
+					errs[w] = fmt.Errorf("%s: %w", embeddings[id].Location, err)
+				}
+				matches[i] = Match{Index: id, Similarity: similarity}
 			}
 			wg.Done()
-		}()
+		}(w)
 	}
-	for i := range embeddings {
+	for i := range candidates {
 		jobs <- i
 	}
 	close(jobs)
 	wg.Wait()
-	close(results)
-	return embeddings
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
 }
 
-func getSearchVector(query string, loc LocationStruct, embeddingsByChapter []Embedding, embeddingsByVerse []Embedding, verseMap map[string]string) []float64 {
-	vector := make([]float64, len(embeddingsByVerse[0].Embedding))
-	foundLocalEmbedding := false
-	if loc.HasLocation {
-		foundLocalEmbedding, vector = getEmbeddingByLocation(loc.LocationString, embeddingsByChapter)
+// materializeMatches copies the matched embeddings, in match order, with each
+// copy's Similarity set from its match.
+func materializeMatches(embeddings []Embedding, matches []Match) []Embedding {
+	results := make([]Embedding, len(matches))
+	for i, m := range matches {
+		results[i] = embeddings[m.Index]
+		results[i].Similarity = m.Similarity
+	}
+	return results
+}
 
-		if !foundLocalEmbedding {
-			foundLocalEmbedding, vector = getEmbeddingByLocation(loc.LocationString, embeddingsByVerse)
+func getSearchVector(query string, loc LocationStruct, corpus *Corpus, embedder embeddings.Embedder) ([]float32, error) {
+	if loc.HasLocation {
+		if found, vector := getEmbeddingByLocation(loc.LocationString, corpus.Chapters); found {
+			return vector, nil
+		}
+		if found, vector := getEmbeddingByLocation(loc.LocationString, corpus.Verses); found {
+			return vector, nil
 		}
 	}
-	if !foundLocalEmbedding {
-		vector = getQueryEmbedding(query)
-	}
-	return vector
+	return getQueryEmbedding(query, embedder)
 }
 
-func getQueryEmbedding(query string) []float64 {
+func getQueryEmbedding(query string, embedder embeddings.Embedder) ([]float32, error) {
 	fmt.Println("Got embedding query")
-	godotenv.Load()
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-	request := openai.EmbeddingRequest{
-		Input: []string{query},
-		Model: openai.AdaEmbeddingV2,
-	}
-	resp, err := client.CreateEmbeddings(context.Background(), request)
+	embedding, err := embedder.Embed(context.Background(), query)
 	if err != nil {
-		fmt.Printf("Error creating embeddings: %s", err)
-		panic(err)
-	}
-	embedding := make([]float64, len(resp.Data[0].Embedding))
-	for i, v := range resp.Data[0].Embedding {
-		embedding[i] = float64(v)
+		fmt.Printf("Error creating embeddings: %s\n", err)
+		return nil, err
 	}
-	return embedding
+	return embeddings.ToFloat32(embedding), nil
 }
 
-func SwapQueryForPassage(query string, loc LocationStruct, verseMap map[string]string) string {
+func SwapQueryForPassage(query string, loc LocationStruct, corpus *Corpus) string {
 	fmt.Print("User Input: " + query + "\n")
 	// Check if the query is a valid Bible verse, passage, or chapter
 
 	newVerseQuery := ""
 
 	if loc.HasLocation {
-		if loc.VerseEnd > 0 && loc.VerseEnd > loc.Verse {
-			newVerseQuery = buildPassageFromLocation(loc, verseMap).Verse
+		if loc.VerseEnd > 0 {
+			newVerseQuery = buildPassageFromLocation(loc, corpus).Verse
 			fmt.Print("New Query: " + newVerseQuery + "\n")
 			return newVerseQuery
 		}
@@ -135,12 +226,12 @@ func SwapQueryForPassage(query string, loc LocationStruct, verseMap map[string]s
 	return query
 }
 
-func getEmbeddingByLocation(location string, embeddings []Embedding) (bool, []float64) {
+func getEmbeddingByLocation(location string, embeddings []Embedding) (bool, []float32) {
 	for _, embedding := range embeddings {
 		if embedding.Location == location {
 			fmt.Print("FOUND EMBEDDING: " + embedding.Location + "\n")
 			return true, embedding.Embedding
 		}
 	}
-	return false, []float64{}
+	return false, []float32{}
 }
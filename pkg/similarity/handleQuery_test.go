@@ -0,0 +1,112 @@
+package similarity
+
+import (
+	"errors"
+	"go-scripture/pkg/embeddings"
+	"go-scripture/pkg/index"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestFindSimilaritiesConcurrent runs many searches at once over one corpus,
+// as concurrent requests do, and checks each gets the results it gets alone
+// and that the corpus is left untouched. Run it with -race.
+func TestFindSimilaritiesConcurrent(t *testing.T) {
+	corpus, embedder := newTestCorpus(t)
+	before := append([]Embedding(nil), corpus.Verses...)
+
+	searches := []struct {
+		query, searchBy string
+		opts            SearchOptions
+	}{
+		{"grace and truth", "verse", DefaultSearchOptions()},
+		{"the wicked in his pride", "verse", DefaultSearchOptions()},
+		{"make a joyful noise", "chapter", DefaultSearchOptions()},
+		{"John 3:16", "verse", DefaultSearchOptions()},
+		{"born again", "passage", SearchOptions{MinScore: -1}},
+	}
+
+	search := func(i int) []Embedding {
+		s := searches[i]
+		loc, err := DetectLocation(s.query, corpus, s.opts.ReferenceMode)
+		if err != nil {
+			t.Errorf("%q: %v", s.query, err)
+		}
+		found, _, err := FindSimilarities(s.query, loc, corpus, embedder, s.searchBy, nil, s.opts)
+		if err != nil {
+			t.Errorf("%q: %v", s.query, err)
+		}
+		return found
+	}
+	want := make([][]Embedding, len(searches))
+	for i := range searches {
+		if want[i] = search(i); len(want[i]) == 0 {
+			t.Fatalf("%q: no results", searches[i].query)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				i := (g + n) % len(searches)
+				if got := search(i); !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("%q: concurrent results differ from sequential ones", searches[i].query)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(corpus.Verses, before) {
+		t.Error("searching modified the corpus")
+	}
+}
+
+func TestFindSimilaritiesErrors(t *testing.T) {
+	corpus, embedder := newTestCorpus(t)
+	indexed, _ := newTestCorpus(t)
+	indexed.VerseIndex = index.BuildIVF(vectorsOf(indexed.Verses), 4, 1)
+	noChapters := NewCorpus(nil, corpus.Verses)
+
+	tests := []struct {
+		name     string
+		corpus   *Corpus
+		searchBy string
+		vector   []float32
+		opts     SearchOptions
+		want     error
+	}{
+		{"no chapters", noChapters, "chapter", nil, DefaultSearchOptions(), ErrEmptyCorpus},
+		{"wrong dimension", corpus, "verse", make([]float32, testDimension+1), DefaultSearchOptions(), embeddings.ErrDimensionMismatch},
+		{"offset beyond the index", indexed, "verse", nil, SearchOptions{Limit: 10, Offset: IndexDepth, UseIndex: true}, ErrBeyondIndex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := FindSimilarities("grace and truth", LocationStruct{}, tt.corpus, embedder, tt.searchBy, tt.vector, tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// An exact search pages past IndexDepth freely.
+	if _, _, err := FindSimilarities("grace and truth", LocationStruct{}, indexed, embedder, "verse", nil, SearchOptions{Limit: 10, Offset: IndexDepth}); err != nil {
+		t.Errorf("exact search: %v", err)
+	}
+}
+
+func TestDetectLocationErrors(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	if _, err := DetectLocation("John 3:40", corpus, ReferenceForce); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("forced John 3:40: error = %v, want ErrReferenceNotFound", err)
+	}
+	loc, err := DetectLocation("John 3:40", corpus, ReferenceAuto)
+	if err != nil || loc.HasLocation {
+		t.Errorf("auto John 3:40 = %+v, %v, want it ignored", loc, err)
+	}
+}
@@ -0,0 +1,68 @@
+package similarity
+
+import "math"
+
+// SearchMode chooses how verses are ranked.
+type SearchMode string
+
+const (
+	// ModeSemantic ranks by embedding similarity alone.
+	ModeSemantic SearchMode = "semantic"
+	// ModeHybrid fuses the semantic ranking with the BM25 keyword ranking.
+	ModeHybrid SearchMode = "hybrid"
+)
+
+// FusionMethod is how a hybrid search combines its two rankings.
+type FusionMethod string
+
+const (
+	// FusionRRF sums alpha/(k+rank) from the semantic ranking and
+	// (1-alpha)/(k+rank) from the keyword ranking (reciprocal rank fusion).
+	FusionRRF FusionMethod = "rrf"
+	// FusionWeighted sums alpha times the semantic score and 1-alpha times the
+	// keyword score, each min-max scaled to 0..1 first.
+	FusionWeighted FusionMethod = "weighted"
+)
+
+const (
+	// rrfK damps the advantage of the very top ranks, as in the original RRF
+	// paper.
+	rrfK = 60
+	// hybridDepth is how far down each ranking hybrid search looks.
+	hybridDepth = 1000
+)
+
+// fuseMatches combines semantic and keyword matches over the same embeddings
+// into one unordered list scored by method. alpha weights the semantic side.
+func fuseMatches(semantic []Match, keyword []Match, method FusionMethod, alpha float64) []Match {
+	semantic, _ = selectTopMatches(semantic, hybridDepth, math.Inf(-1))
+	keyword, _ = selectTopMatches(keyword, hybridDepth, math.Inf(-1))
+
+	scores := make(map[int]float64, len(semantic)+len(keyword))
+	add := func(matches []Match, weight float64) {
+		if len(matches) == 0 {
+			return
+		}
+		low, high := matches[len(matches)-1].Similarity, matches[0].Similarity
+		for rank, m := range matches {
+			switch method {
+			case FusionWeighted:
+				scaled := 1.0
+				if high > low {
+					scaled = (m.Similarity - low) / (high - low)
+				}
+				scores[m.Index] += weight * scaled
+			default:
+				scores[m.Index] += weight / float64(rrfK+rank+1)
+			}
+		}
+	}
+	add(semantic, alpha)
+	add(keyword, 1-alpha)
+
+	fused := make([]Match, 0, len(scores))
+	for i, score := range scores {
+		fused = append(fused, Match{Index: i, Similarity: score})
+	}
+	return fused
+}
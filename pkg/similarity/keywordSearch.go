@@ -0,0 +1,31 @@
+package similarity
+
+// FindKeywordMatches ranks the verses of corpus by the BM25 score of their
+// text against query, without embeddings. It returns copies of the requested
+// page of verses carrying their scores, plus the number of verses containing a
+// query term, allowed by opts.Filter and scoring at least opts.MinScore.
+func FindKeywordMatches(query string, corpus *Corpus, opts SearchOptions) ([]Embedding, int) {
+	matches := keywordMatches(query, corpus)
+	if allowed := opts.Filter.candidates(corpus.Verses, corpus.Versification); allowed != nil {
+		matches = filterMatches(matches, allowed)
+	}
+
+	k := 0
+	if opts.Limit > 0 {
+		k = opts.Offset + opts.Limit
+	}
+	top, total := selectTopMatches(matches, k, opts.MinScore)
+	if opts.Offset >= len(top) {
+		return []Embedding{}, total
+	}
+	return materializeMatches(corpus.Verses, top[opts.Offset:]), total
+}
+
+func keywordMatches(query string, corpus *Corpus) []Match {
+	hits := corpus.Keywords.Search(query)
+	matches := make([]Match, len(hits))
+	for i, hit := range hits {
+		matches[i] = Match{Index: hit.ID, Similarity: hit.Score}
+	}
+	return matches
+}
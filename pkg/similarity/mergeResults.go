@@ -0,0 +1,234 @@
+package similarity
+
+import (
+	"go-scripture/pkg/reference"
+	"math"
+	"sort"
+)
+
+// MergedResult is a result of a search across verses, chapters and passages,
+// standing for the results covering the same text that it absorbed.
+type MergedResult struct {
+	Embedding
+	// Absorbed holds the locations of the best maxAbsorbed absorbed results,
+	// best first.
+	Absorbed []string
+}
+
+// maxAbsorbed bounds MergedResult.Absorbed, which for a chapter could
+// otherwise list every verse in it.
+const maxAbsorbed = 10
+
+// absorb records location, unless it is already listed: a one-verse passage is
+// the verse again, not another result.
+func (m *MergedResult) absorb(location string) {
+	if location == m.Location || len(m.Absorbed) == maxAbsorbed {
+		return
+	}
+	for _, absorbed := range m.Absorbed {
+		if absorbed == location {
+			return
+		}
+	}
+	m.Absorbed = append(m.Absorbed, location)
+}
+
+// exactMatchStandardScore is the standard score of a result a query names,
+// further above the mean than any real match.
+const exactMatchStandardScore = 10
+
+// ScoreStats are the mean and standard deviation of the scores of one kind of
+// result. Chapter similarities run on a different scale from verse
+// similarities, and hybrid verse scores on another again, so they are only
+// comparable once standardized against their own kind.
+type ScoreStats struct {
+	Mean   float64
+	StdDev float64
+}
+
+// StatsOf computes the ScoreStats of the similarities of population.
+func StatsOf(population []Embedding) ScoreStats {
+	scores := make([]float64, len(population))
+	for i, e := range population {
+		scores[i] = e.Similarity
+	}
+	return statsOfScores(scores)
+}
+
+func statsOfScores(scores []float64) ScoreStats {
+	if len(scores) == 0 {
+		return ScoreStats{}
+	}
+	var sum, sumSquares float64
+	for _, s := range scores {
+		sum += s
+		sumSquares += s * s
+	}
+	n := float64(len(scores))
+	mean := sum / n
+	return ScoreStats{Mean: mean, StdDev: math.Sqrt(math.Max(sumSquares/n-mean*mean, 0))}
+}
+
+// ChapterStats computes the ScoreStats of every chapter filter allows against
+// searchTermVector. There are few enough chapters to score them all, and
+// nothing is sorted or copied.
+func ChapterStats(corpus *Corpus, searchTermVector []float32, filter Filter) (ScoreStats, error) {
+	matches, err := calculateEmbeddingSimilarity(corpus.Chapters, filter.candidates(corpus.Chapters, corpus.Versification), searchTermVector)
+	if err != nil {
+		return ScoreStats{}, err
+	}
+	scores := make([]float64, len(matches))
+	for i, m := range matches {
+		scores[i] = m.Similarity
+	}
+	return statsOfScores(scores), nil
+}
+
+// Standardize rescales the similarities of results to standard scores: how
+// many standard deviations each stands above the mean. A result the query
+// names keeps its place at the top.
+func (s ScoreStats) Standardize(results []Embedding) {
+	for i := range results {
+		if results[i].Similarity == exactMatchScore {
+			results[i].Similarity = exactMatchStandardScore
+		} else if s.StdDev == 0 {
+			results[i].Similarity = 0
+		} else {
+			results[i].Similarity = (results[i].Similarity - s.Mean) / s.StdDev
+		}
+	}
+}
+
+// verseSpan is the canonical positions of the first and last verse a result
+// covers.
+type verseSpan struct {
+	start, end int
+	ok         bool
+}
+
+func (s verseSpan) width() int {
+	if !s.ok {
+		return 0
+	}
+	return s.end - s.start
+}
+
+// MergeResults ranks results of every granularity, already scored on one
+// scale, together, and collapses those covering the same text: a result that
+// contains, or is contained by, a better one is absorbed into it, so John 3:16,
+// John 3:16-18 and John 3 come back once. Between equal scores the result
+// covering fewer verses is kept. Results partly overlapping are both kept.
+//
+// It returns the page of opts, after dropping results below opts.MinScore and
+// applying opts.Diversity, and the number of merged results left.
+func MergeResults(results []Embedding, versification *reference.Versification, opts SearchOptions) ([]MergedResult, int) {
+	var kept []Embedding
+	for _, e := range results {
+		if e.Similarity >= opts.MinScore {
+			kept = append(kept, e)
+		}
+	}
+	spans := make([]verseSpan, len(kept))
+	for i, e := range kept {
+		spans[i] = spanOf(e.Location, versification)
+	}
+	order := make([]int, len(kept))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		x, y := order[a], order[b]
+		if kept[x].Similarity != kept[y].Similarity {
+			return kept[x].Similarity > kept[y].Similarity
+		}
+		return spans[x].width() < spans[y].width()
+	})
+
+	var merged []MergedResult
+	var mergedSpans []verseSpan
+	// covering[p] lists the merged results covering the verse at position p.
+	covering := make(map[int][]int)
+	for _, i := range order {
+		span := spans[i]
+		if !span.ok {
+			merged = append(merged, MergedResult{Embedding: kept[i]})
+			mergedSpans = append(mergedSpans, span)
+			continue
+		}
+		if into := absorbingResult(span, covering, mergedSpans); into >= 0 {
+			merged[into].absorb(kept[i].Location)
+			continue
+		}
+		for p := span.start; p <= span.end; p++ {
+			covering[p] = append(covering[p], len(merged))
+		}
+		merged = append(merged, MergedResult{Embedding: kept[i]})
+		mergedSpans = append(mergedSpans, span)
+	}
+
+	if !opts.Diversity.IsEmpty() {
+		if depth := opts.Diversity.depth(opts.Offset + opts.Limit); len(merged) > depth {
+			merged = merged[:depth]
+		}
+		found := make([]Embedding, len(merged))
+		for i := range merged {
+			found[i] = merged[i].Embedding
+		}
+		order := opts.Diversity.diversify(found)
+		ranked := make([]MergedResult, len(order))
+		for i, j := range order {
+			ranked[i] = merged[j]
+		}
+		merged = ranked
+	}
+
+	total := len(merged)
+	if opts.Offset >= total {
+		return []MergedResult{}, total
+	}
+	merged = merged[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(merged) {
+		merged = merged[:opts.Limit]
+	}
+	return merged, total
+}
+
+// absorbingResult returns the best merged result, the first merged, that
+// contains span or is contained by it, or -1 if there is none. Either way the
+// two share the verses of the inner one, so only results covering a verse of
+// span need checking.
+func absorbingResult(span verseSpan, covering map[int][]int, mergedSpans []verseSpan) int {
+	best := -1
+	for p := span.start; p <= span.end; p++ {
+		for _, r := range covering[p] {
+			if best >= 0 && r >= best {
+				continue
+			}
+			other := mergedSpans[r]
+			if (other.start <= span.start && span.end <= other.end) || (span.start <= other.start && other.end <= span.end) {
+				best = r
+			}
+		}
+	}
+	return best
+}
+
+// spanOf finds the verses a result location covers, which is always one run
+// of consecutive verses: "John 3", "John 3:16" or "Matthew 5:43-6:4".
+func spanOf(location string, versification *reference.Versification) verseSpan {
+	refs, err := reference.Parse(location)
+	if err != nil || len(refs) != 1 || len(refs[0].Ranges) != 1 {
+		return verseSpan{}
+	}
+	book, rg := refs[0].Book, refs[0].Ranges[0]
+	first, last := rg.StartVerse, rg.EndVerse
+	if first == 0 {
+		first = 1
+	}
+	if last == 0 {
+		last = versification.VerseCount(book, rg.EndChapter)
+	}
+	start, startOK := versification.Position(book, rg.StartChapter, first)
+	end, endOK := versification.Position(book, rg.EndChapter, last)
+	return verseSpan{start: start, end: end, ok: startOK && endOK && start <= end}
+}
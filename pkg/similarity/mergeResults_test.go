@@ -0,0 +1,184 @@
+package similarity
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	type result struct {
+		location string
+		absorbed []string
+	}
+	tests := []struct {
+		name    string
+		results []Embedding
+		want    []result
+	}{
+		{
+			name: "verse, passage and chapter collapse",
+			results: []Embedding{
+				{Location: "John 3", Similarity: 1.0},
+				{Location: "John 3:16-17", Similarity: 1.5},
+				{Location: "John 3:16", Similarity: 2.0},
+				{Location: "Jude 1:24", Similarity: 0.5},
+			},
+			want: []result{
+				{"John 3:16", []string{"John 3:16-17", "John 3"}},
+				{"Jude 1:24", nil},
+			},
+		},
+		{
+			name: "chapter first absorbs what it contains",
+			results: []Embedding{
+				{Location: "John 3:16", Similarity: 1.0},
+				{Location: "John 3", Similarity: 2.0},
+				{Location: "John 3:16-17", Similarity: 1.5},
+			},
+			want: []result{
+				{"John 3", []string{"John 3:16-17", "John 3:16"}},
+			},
+		},
+		{
+			name: "fewer verses wins a tie",
+			results: []Embedding{
+				{Location: "John 3:16-18", Similarity: 1.0},
+				{Location: "John 3:16", Similarity: 1.0},
+			},
+			want: []result{
+				{"John 3:16", []string{"John 3:16-18"}},
+			},
+		},
+		{
+			name: "partial overlaps are both kept",
+			results: []Embedding{
+				{Location: "John 3:16-17", Similarity: 2.0},
+				{Location: "John 3:17-18", Similarity: 1.0},
+			},
+			want: []result{
+				{"John 3:16-17", nil},
+				{"John 3:17-18", nil},
+			},
+		},
+		{
+			name: "one-verse passage is the verse again",
+			results: []Embedding{
+				{Location: "John 3:16", Similarity: 2.0},
+				{Location: "John 3:16", Similarity: 1.0},
+			},
+			want: []result{
+				{"John 3:16", nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, total := MergeResults(tt.results, corpus.Versification, SearchOptions{MinScore: math.Inf(-1)})
+
+			var got []result
+			for _, m := range merged {
+				got = append(got, result{m.Location, m.Absorbed})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if total != len(tt.want) {
+				t.Errorf("total = %d, want %d", total, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestMergeResultsPages(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	results := []Embedding{
+		{Location: "John 3:16", Similarity: 3},
+		{Location: "John 3:16-17", Similarity: 2.5},
+		{Location: "Jude 1:24", Similarity: 2},
+		{Location: "Psalms 1:1", Similarity: 1},
+		{Location: "Psalms 10:1", Similarity: -1},
+	}
+	merged, total := MergeResults(results, corpus.Versification, SearchOptions{MinScore: 0, Offset: 1, Limit: 1})
+	if total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+	if len(merged) != 1 || merged[0].Location != "Jude 1:24" {
+		t.Errorf("page = %+v, want Jude 1:24", merged)
+	}
+}
+
+// TestMergeResultsStandardizes ranks verses and chapters whose similarities
+// run on different scales: the best chapter, well above the other chapters,
+// outranks the best verse, whose similarity is higher but less far above the
+// other verses.
+func TestMergeResultsStandardizes(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	verses := []Embedding{
+		{Location: "Psalms 1:1", Similarity: 0.90},
+		{Location: "Psalms 1:2", Similarity: 0.82},
+		{Location: "Psalms 1:3", Similarity: 0.80},
+		{Location: "Psalms 1:4", Similarity: 0.78},
+	}
+	chapters := []Embedding{
+		{Location: "John 3", Similarity: 0.40},
+		{Location: "Psalms 100", Similarity: 0.29},
+		{Location: "Psalms 10", Similarity: 0.28},
+		{Location: "Revelation 1", Similarity: 0.27},
+	}
+	StatsOf(verses).Standardize(verses)
+	StatsOf(chapters).Standardize(chapters)
+
+	merged, _ := MergeResults(append(verses, chapters...), corpus.Versification, SearchOptions{MinScore: math.Inf(-1)})
+	var got []string
+	for _, m := range merged {
+		got = append(got, m.Location)
+	}
+	want := []string{"John 3", "Psalms 1:1", "Psalms 1:2", "Psalms 100", "Psalms 1:3", "Psalms 10", "Revelation 1", "Psalms 1:4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestScoreStats(t *testing.T) {
+	stats := StatsOf([]Embedding{{Similarity: 1}, {Similarity: 2}, {Similarity: 3}, {Similarity: 4}})
+	if stats.Mean != 2.5 || math.Abs(stats.StdDev-math.Sqrt(1.25)) > 1e-12 {
+		t.Errorf("stats = %+v, want mean 2.5 and standard deviation %v", stats, math.Sqrt(1.25))
+	}
+
+	results := []Embedding{{Similarity: 2.5}, {Similarity: 2.5 + math.Sqrt(1.25)}, {Similarity: exactMatchScore}}
+	stats.Standardize(results)
+	for i, want := range []float64{0, 1, exactMatchStandardScore} {
+		if math.Abs(results[i].Similarity-want) > 1e-12 {
+			t.Errorf("result %d = %v, want %v", i, results[i].Similarity, want)
+		}
+	}
+
+	flat := []Embedding{{Similarity: 0.5}}
+	StatsOf(flat).Standardize(flat)
+	if flat[0].Similarity != 0 {
+		t.Errorf("score with no spread = %v, want 0", flat[0].Similarity)
+	}
+}
+
+func TestChapterStats(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	vector := corpus.Verses[0].Embedding
+
+	var scored []Embedding
+	for _, e := range corpus.Chapters {
+		similarity, err := cosineSimilarity(e.Embedding, vector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scored = append(scored, Embedding{Similarity: similarity})
+	}
+	stats, err := ChapterStats(corpus, vector, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := StatsOf(scored); math.Abs(stats.Mean-want.Mean) > 1e-9 || math.Abs(stats.StdDev-want.StdDev) > 1e-9 {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
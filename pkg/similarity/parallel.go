@@ -0,0 +1,70 @@
+package similarity
+
+import (
+	"go-scripture/pkg/reference"
+	"strconv"
+	"strings"
+)
+
+// ParallelVerse is one verse of a result in one translation. Missing marks a
+// verse the translation does not have, such as those omitted from modern
+// critical texts.
+type ParallelVerse struct {
+	Verse   string `json:"verse"`
+	Text    string `json:"text"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// VerseIDs expands a result location ("John 3", "John 3:16" or "Matthew
+// 5:43-6:4") into the locations of the verses it covers, in order, as numbered
+// by this corpus's versification.
+func (c *Corpus) VerseIDs(location string) []string {
+	refs, err := reference.Parse(location)
+	if err != nil {
+		return nil
+	}
+
+	var ids []string
+	for _, ref := range refs {
+		for _, rg := range ref.Ranges {
+			for chapter := rg.StartChapter; chapter <= rg.EndChapter; chapter++ {
+				first, last := 1, c.Versification.VerseCount(ref.Book, chapter)
+				if chapter == rg.StartChapter && rg.StartVerse > 0 {
+					first = rg.StartVerse
+				}
+				if chapter == rg.EndChapter && rg.EndVerse > 0 {
+					last = rg.EndVerse
+				}
+				for verse := first; verse <= last; verse++ {
+					ids = append(ids, ref.Book.Name+" "+strconv.Itoa(chapter)+":"+strconv.Itoa(verse))
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// ParallelText lines up the verses of a result location in each of corpora,
+// keyed by translation. Every translation lists the same verses, in the order
+// the searched corpus numbers them.
+func (c *Corpus) ParallelText(location string, corpora []*Corpus) map[string][]ParallelVerse {
+	ids := c.VerseIDs(location)
+	parallel := make(map[string][]ParallelVerse, len(corpora))
+	for _, other := range corpora {
+		verses := make([]ParallelVerse, len(ids))
+		for i, id := range ids {
+			text, ok := other.VerseMap[id]
+			verses[i] = ParallelVerse{Verse: id, Text: verseText(text), Missing: !ok}
+		}
+		parallel[other.Translation] = verses
+	}
+	return parallel
+}
+
+// verseText drops the verse number VerseMap entries start with.
+func verseText(entry string) string {
+	if space := strings.IndexByte(entry, ' '); space >= 0 {
+		return entry[space+1:]
+	}
+	return entry
+}
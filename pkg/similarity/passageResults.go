@@ -1,238 +1,265 @@
 package similarity
 
 import (
-	"fmt"
-	"regexp"
+	"go-scripture/pkg/reference"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-func FindBestPassages(verses []Embedding, windowSize int, numSequences int) []Embedding {
-	if len(verses) == 0 {
-		fmt.Println("Error: no verses provided")
-		return nil
-	}
+// PassageOptions shapes the passages FindPassages returns.
+type PassageOptions struct {
+	// MinLen and MaxLen bound the number of verses in a passage.
+	MinLen int
+	MaxLen int
+	// GapTolerance is how many consecutive weak verses a passage may bridge.
+	GapTolerance int
+}
 
-	if windowSize <= 0 || numSequences <= 0 {
-		fmt.Println("Error: windowSize and numSequences must be greater than zero")
-		return nil
-	}
+func DefaultPassageOptions() PassageOptions {
+	return PassageOptions{MinLen: 1, MaxLen: 12, GapTolerance: 1}
+}
 
-	// Sort the verses list by Location and Verse.
-	sort.Slice(verses, func(i, j int) bool {
-		if verses[i].Location == verses[j].Location {
-			return verses[i].Verse < verses[j].Verse
+// segment is a run of verses[start:end] within one book.
+type segment struct {
+	start, end int
+	gain       float64
+}
+
+// FindPassages finds the passages that best match a query, given every verse
+// scored against it. Each verse gains its score minus a baseline, the mean
+// plus one standard deviation of all scores, so only verses that stand out
+// add to a passage. Within each book the highest-gain runs of consecutive
+// verses, which may cross chapters, are taken in turn until none gain
+// anything. A passage is scored by the mean similarity of its verses, so its
+// score reads like a verse score.
+//
+// When the query names a verse or passage, loc, that passage is returned first
+// with the exact-match score.
+func FindPassages(verses []Embedding, loc LocationStruct, corpus *Corpus, opts PassageOptions) []Embedding {
+	var passages []Embedding
+
+	if loc.HasLocation && loc.Verse > 0 {
+		if referenced := buildPassageFromLocation(loc, corpus); strings.TrimSpace(referenced.Verse) != "" {
+			passages = append(passages, referenced)
 		}
-		return verses[i].Location < verses[j].Location
-	})
+	}
+	if len(verses) == 0 {
+		return passages
+	}
 
-	var bestSequences []Embedding
-	for i := 0; i < numSequences; i++ {
-		// Iterate over the verses list using a sliding window of size `windowSize`.
-		bestWindow := make([]Embedding, windowSize)
-		bestScore := 0.0
-
-		for j := i; j <= len(verses)-windowSize && j >= 0; j += numSequences {
-			window := verses[j : j+windowSize]
-			// Calculate the average similarity score for all Embedding structs in the window.
-			sumScore := 0.0
-			for _, e := range window {
-				sumScore += e.Similarity
-			}
-			avgScore := sumScore / float64(windowSize)
+	keys := sortCanonically(verses, corpus.Versification)
+	baseline := passageBaseline(verses)
 
-			// Update the best window, score, and start index if a higher score is found.
-			if avgScore > bestScore {
-				copy(bestWindow, window)
-				bestScore = avgScore
-			}
+	var found []Embedding
+	for start := 0; start < len(verses); {
+		end := start + 1
+		for end < len(verses) && sameBookRun(keys[end-1], keys[end]) {
+			end++
 		}
-
-		// Extract book and chapter from the Location field of the first verse in the best window.
-		bookAndChapter := bestWindow[0].Location[:strings.LastIndex(bestWindow[0].Location, ":")]
-		verseStart := bestWindow[0].Location[strings.LastIndex(bestWindow[0].Location, ":")+1:]
-		verseEnd := bestWindow[len(bestWindow)-1].Location[strings.LastIndex(bestWindow[len(bestWindow)-1].Location, ":")+1:]
-		bestLocation := fmt.Sprintf("%s:%s-%s", bookAndChapter, verseStart, verseEnd)
-
-		// Concatenate verses in the best window.
-		var bestVerse strings.Builder
-		for _, e := range bestWindow {
-			if bestVerse.Len() > 0 {
-				bestVerse.WriteString(" ")
+		if keys[start].ok {
+			for _, seg := range bestSegments(verses[start:end], baseline, opts) {
+				found = append(found, passageOf(verses[start+seg.start:start+seg.end], keys[start+seg.start:start+seg.end], corpus.VerseMap))
 			}
-			verseNum := e.Location[strings.LastIndex(e.Location, ":")+1:]
-			verseStr := verseNum + " " + e.Verse
-
-			bestVerse.WriteString(verseStr)
 		}
-
-		// Append the best sequence to the list of best sequences.
-		bestSequences = append(bestSequences, Embedding{Location: bestLocation, Verse: bestVerse.String(), Similarity: bestScore})
+		start = end
 	}
 
-	// Sort bestSequences by Similarity in descending order.
-	sort.Slice(bestSequences, func(i, j int) bool {
-		return bestSequences[i].Similarity > bestSequences[j].Similarity
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Similarity > found[j].Similarity
 	})
-
-	return bestSequences
-}
-
-func MergePassageResults(unmergedBestPassageResults []Embedding, query string, verseMap map[string]string) []Embedding {
-	chapters := make(map[string][]Tuple)
-
-	// Define a regular expression pattern
-	pattern := `^([\w\s]+ \d{1,2}):(\d+)-(\d+)`
-
-	// Create a regular expression object
-	regex := regexp.MustCompile(pattern)
-
-	for i := range unmergedBestPassageResults {
-		// Test if a string matches the pattern
-		matches := regex.FindAllStringSubmatch(unmergedBestPassageResults[i].Location, -1)
-		if len(matches) > 0 && len(matches[0]) > 1 {
-			_, ok := chapters[matches[0][1]]
-			if ok {
-				if len(matches[0]) > 2 {
-					num, _ := strconv.Atoi(matches[0][2])
-					verseSimilarity := Tuple{num, unmergedBestPassageResults[i].Similarity}
-					chapters[matches[0][1]] = append(chapters[matches[0][1]], verseSimilarity)
-				}
-			} else {
-				if len(matches[0]) > 2 {
-					num, _ := strconv.Atoi(matches[0][2])
-					chapters[matches[0][1]] = make([]Tuple, 0)
-					verseSimilarity := Tuple{num, unmergedBestPassageResults[i].Similarity}
-					chapters[matches[0][1]] = append(chapters[matches[0][1]], verseSimilarity)
-				}
-			}
+	for _, p := range found {
+		if len(passages) > 0 && p.Location == passages[0].Location {
+			continue
 		}
+		passages = append(passages, p)
 	}
-
-	return buildPassageResults(chapters, query, verseMap)
+	return passages
 }
 
-func buildPassageResults(chapters map[string][]Tuple, query string, verseMap map[string]string) []Embedding {
-	newPassages := make([]Embedding, 0)
-
-	for k, v := range chapters {
-		sort.Slice(v, func(i, j int) bool {
-			return v[i].First < v[j].First
-		})
-
-		startRange := -1
-		endRange := -1
-		avgSim := 0.0
-		runningCount := 0
+// sameBookRun reports whether b directly follows a in the same book.
+func sameBookRun(a, b verseKey) bool {
+	return a.ok && b.ok && b.position == a.position+1 && a.book == b.book
+}
 
-		for i := 0; i < len(v); i++ {
-			// loc := k + ":" + strconv.Itoa(v[i].First)
+func passageBaseline(verses []Embedding) float64 {
+	mean := 0.0
+	for _, e := range verses {
+		mean += e.Similarity
+	}
+	mean /= float64(len(verses))
 
-			if startRange == -1 {
-				startRange = v[i].First
-			}
-			endRange = v[i].First
-
-			avgSim += v[i].Second
-			runningCount++
-
-			// Check if the next verse is not consecutive or if it's the last verse in the array
-			if i == len(v)-1 || (v[i+1].First != v[i].First+1 && v[i+1].First != v[i].First+2 && v[i+1].First != v[i].First+3) {
-				// Rebuild the verses based on the first and last in the current consec range
-				consec := ""
-				for r := startRange; r <= endRange; r++ {
-					loc := k + ":" + strconv.Itoa(r)
-					consec += getVerse(loc, verseMap) + " "
-				}
+	variance := 0.0
+	for _, e := range verses {
+		variance += (e.Similarity - mean) * (e.Similarity - mean)
+	}
+	return mean + math.Sqrt(variance/float64(len(verses)))
+}
 
-				if endRange > startRange { // Check if the passage has more than one verse
-					newE := Embedding{
-						Location:   k + ":" + strconv.Itoa(startRange) + "-" + strconv.Itoa(endRange),
-						Verse:      consec,
-						Similarity: avgSim / float64(runningCount),
+// bestSegments repeatedly takes the highest-gain segment of consecutive verses
+// that no earlier segment overlaps, honouring opts, until no segment has a
+// positive gain. Segments come back in the order they were taken.
+func bestSegments(verses []Embedding, baseline float64, opts PassageOptions) []segment {
+	gains := make([]float64, len(verses))
+	for i, e := range verses {
+		gains[i] = e.Similarity - baseline
+	}
+	taken := make([]bool, len(verses))
+
+	var segments []segment
+	for {
+		best := segment{}
+		for s := range gains {
+			gain, weakRun := 0.0, 0
+			for e := s; e < len(gains) && e-s < opts.MaxLen && !taken[e]; e++ {
+				gain += gains[e]
+				if gains[e] < 0 {
+					if weakRun++; weakRun > opts.GapTolerance {
+						break
 					}
-
-					newPassages = append(newPassages, newE)
+				} else {
+					weakRun = 0
+				}
+				if e-s+1 >= opts.MinLen && gain > best.gain {
+					best = segment{start: s, end: e + 1, gain: gain}
 				}
-
-				// Reset avgSim, runningCount, startRange, and endRange for the next passage
-				avgSim = 0.0
-				runningCount = 0
-				startRange = -1
-				endRange = -1
 			}
 		}
+		if best.gain <= 0 {
+			return segments
+		}
+		for i := best.start; i < best.end; i++ {
+			taken[i] = true
+		}
+		segments = append(segments, best)
 	}
+}
 
-	loc := checkIfLocation(query)
-	locStringPassage := ""
-
-	if loc.HasLocation && loc.Verse > 0 && loc.VerseEnd > 0 {
-		locStringPassage = fmt.Sprintf("%s %d:%d-%d", loc.Book, loc.Chapter, loc.Verse, loc.VerseEnd)
-		fmt.Print("Has location\n")
-		fmt.Print("Found passage\n")
-		fmt.Print("Location: ", locStringPassage, "\n")
+// passageOf joins consecutive verses of one book into a passage result.
+func passageOf(verses []Embedding, keys []verseKey, verseMap map[string]string) Embedding {
+	first, last := keys[0], keys[len(keys)-1]
+	book, _ := reference.BookByOrder(first.book)
+	ref := reference.Reference{Book: book, Ranges: []reference.Range{{
+		StartChapter: first.chapter,
+		StartVerse:   first.verse,
+		EndChapter:   last.chapter,
+		EndVerse:     last.verse,
+	}}}
+
+	locations := make([]string, len(verses))
+	similarity := 0.0
+	for i, e := range verses {
+		locations[i] = e.Location
+		similarity += e.Similarity
 	}
+	return Embedding{
+		Location:   ref.String(),
+		Verse:      passageText(locations, verseMap),
+		Similarity: similarity / float64(len(verses)),
+	}
+}
 
-	newEmbed := buildPassageFromLocation(loc, verseMap)
-	if strings.TrimSpace(newEmbed.Verse) != "" {
-		newPassages = append(newPassages, newEmbed)
-
-		// Sort bestSequences by Similarity in descending order.
-		sort.Slice(newPassages, func(i, j int) bool {
-			return newPassages[i].Similarity > newPassages[j].Similarity
-		})
-		return newPassages[0 : len(newPassages)-1]
-
+// buildPassageFromLocation builds the passage a location names. A single verse
+// is shown with the two verses after it.
+func buildPassageFromLocation(location LocationStruct, corpus *Corpus) Embedding {
+	book, _ := reference.LookupBook(location.Book)
+	rg := reference.Range{
+		StartChapter: location.Chapter,
+		StartVerse:   location.Verse,
+		EndChapter:   location.ChapterEnd,
+		EndVerse:     location.VerseEnd,
+	}
+	if rg.EndChapter < rg.StartChapter {
+		rg.EndChapter = rg.StartChapter
+	}
+	if location.VerseEnd == 0 {
+		rg.EndVerse = location.Verse + 2
+	}
+	if n := corpus.Versification.VerseCount(book, rg.EndChapter); rg.EndVerse > n {
+		rg.EndVerse = n
 	}
 
-	// Sort bestSequences by Similarity in descending order.
-	sort.Slice(newPassages, func(i, j int) bool {
-		return newPassages[i].Similarity > newPassages[j].Similarity
-	})
+	var locations []string
+	for chapter := rg.StartChapter; chapter <= rg.EndChapter; chapter++ {
+		first, last := 1, corpus.Versification.VerseCount(book, chapter)
+		if chapter == rg.StartChapter {
+			first = rg.StartVerse
+		}
+		if chapter == rg.EndChapter {
+			last = rg.EndVerse
+		}
+		for verse := first; verse <= last; verse++ {
+			locations = append(locations, book.Name+" "+strconv.Itoa(chapter)+":"+strconv.Itoa(verse))
+		}
+	}
 
-	return newPassages
+	return Embedding{
+		Location:   reference.Reference{Book: book, Ranges: []reference.Range{rg}}.String(),
+		Verse:      passageText(locations, corpus.VerseMap),
+		Similarity: exactMatchScore,
+	}
 }
 
-func buildPassageFromLocation(location LocationStruct, verseMap map[string]string) Embedding {
-	// Create a new Embedding object
-	numberOfVerses := countVersesInChapter(location.Book, location.Chapter, verseMap)
-	if location.VerseEnd < location.Verse {
-		location.VerseEnd = location.Verse + 2
-	} else if location.VerseEnd > numberOfVerses {
-		location.VerseEnd = numberOfVerses
+// passageText joins the text of consecutive verses, marking the first verse of
+// each new chapter with its chapter number ("6:1 ...").
+func passageText(locations []string, verseMap map[string]string) string {
+	texts := make([]string, len(locations))
+	previousChapter := ""
+	for i, loc := range locations {
+		texts[i] = getVerse(loc, verseMap)
+		colon := strings.LastIndexByte(loc, ':')
+		if colon < 0 {
+			continue
+		}
+		chapter := loc[:colon]
+		if i > 0 && chapter != previousChapter {
+			texts[i] = chapter[strings.LastIndexByte(chapter, ' ')+1:] + ":" + texts[i]
+		}
+		previousChapter = chapter
 	}
+	return strings.Join(texts, " ")
+}
+
+// verseKey places a verse in canonical order. ok is false for verses missing
+// from the versification.
+type verseKey struct {
+	position int
+	book     int
+	chapter  int
+	verse    int
+	ok       bool
+}
 
-	locString := location.Book + " " + strconv.Itoa(location.Chapter) + ":" + strconv.Itoa(location.Verse)
-	consecVerses := ""
-	for i := location.Verse; i <= location.VerseEnd; i++ {
-		locWithCurrentVerse := location.Book + " " + strconv.Itoa(location.Chapter) + ":" + strconv.Itoa(i)
-		consecVerses += getVerse(locWithCurrentVerse, verseMap) + " "
+// sortCanonically orders verses by book, chapter and verse number, rather than
+// by their Location strings, and returns their keys in the same order. Verses
+// missing from versification sort last, in their original order.
+func sortCanonically(verses []Embedding, versification *reference.Versification) []verseKey {
+	type keyed struct {
+		e   Embedding
+		key verseKey
 	}
-	embedding := Embedding{
-		Location:   locString + "-" + strconv.Itoa(location.VerseEnd),
-		Verse:      strings.TrimSpace(consecVerses),
-		Similarity: 0.9999,
+	sorted := make([]keyed, len(verses))
+	for i, e := range verses {
+		sorted[i] = keyed{e: e, key: verseKey{position: versification.Len()}}
+		if book, chapter, verse, ok := reference.SplitLocation(e.Location); ok {
+			if pos, ok := versification.Position(book, chapter, verse); ok {
+				sorted[i].key = verseKey{position: pos, book: book.Order, chapter: chapter, verse: verse, ok: true}
+			}
+		}
 	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].key.position < sorted[j].key.position
+	})
 
-	return embedding
+	keys := make([]verseKey, len(sorted))
+	for i, k := range sorted {
+		verses[i] = k.e
+		keys[i] = k.key
+	}
+	return keys
 }
 
 func getVerse(location string, verseMap map[string]string) string {
 	return verseMap[location]
 }
-
-func countVersesInChapter(book string, chapter int, verseMap map[string]string) int {
-	verseCount := 0
-	for verse := 1; ; verse++ {
-		verseKey := fmt.Sprintf("%s %d:%d", book, chapter, verse)
-		_, exists := verseMap[verseKey]
-		if exists {
-			verseCount++
-		} else {
-			break
-		}
-	}
-	return verseCount
-}
@@ -0,0 +1,178 @@
+package similarity
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSortCanonically(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{
+			name: "verse numbers",
+			in:   []string{"John 3:10", "John 3:2", "John 3:1", "John 3:36"},
+			want: []string{"John 3:1", "John 3:2", "John 3:10", "John 3:36"},
+		},
+		{
+			name: "chapter numbers",
+			in:   []string{"Psalms 100:1", "Psalms 10:1", "Psalms 1:1", "Psalms 10:10", "Psalms 10:2"},
+			want: []string{"Psalms 1:1", "Psalms 10:1", "Psalms 10:2", "Psalms 10:10", "Psalms 100:1"},
+		},
+		{
+			name: "books",
+			in:   []string{"Revelation 1:1", "Jude 1:25", "John 3:16", "Psalms 1:1"},
+			want: []string{"Psalms 1:1", "John 3:16", "Jude 1:25", "Revelation 1:1"},
+		},
+		{
+			name: "unknown verses last",
+			in:   []string{"Genesis 1:1", "John 3:40", "John 3:2", "John 3:1"},
+			want: []string{"John 3:1", "John 3:2", "Genesis 1:1", "John 3:40"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verses := make([]Embedding, len(tt.in))
+			for i, location := range tt.in {
+				verses[i] = Embedding{Location: location}
+			}
+			keys := sortCanonically(verses, corpus.Versification)
+
+			got := make([]string, len(verses))
+			for i, e := range verses {
+				got[i] = e.Location
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for i := 1; i < len(keys); i++ {
+				if keys[i].ok && keys[i].position <= keys[i-1].position {
+					t.Errorf("key %d at position %d does not follow %d", i, keys[i].position, keys[i-1].position)
+				}
+			}
+		})
+	}
+}
+
+func TestFindPassages(t *testing.T) {
+	corpus, _ := newTestCorpus(t)
+	// Runs that sort apart as strings, and two that meet at a book boundary.
+	strong := map[string]bool{
+		"Psalms 10:9": true, "Psalms 10:10": true, "Psalms 10:11": true,
+		"Psalms 100:1": true, "Psalms 100:2": true, "Psalms 100:3": true,
+		"John 3:9": true, "John 3:10": true, "John 3:11": true,
+		"Jude 1:24": true, "Jude 1:25": true,
+		"Revelation 1:1": true, "Revelation 1:2": true,
+	}
+	scored := func() []Embedding {
+		verses := make([]Embedding, len(corpus.Verses))
+		for i, e := range corpus.Verses {
+			verses[i] = Embedding{Location: e.Location, Verse: e.Verse, Similarity: 0.1}
+			if strong[e.Location] {
+				verses[i].Similarity = 0.9
+			}
+		}
+		sort.Slice(verses, func(i, j int) bool {
+			return verses[i].Location < verses[j].Location
+		})
+		return verses
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name: "contiguous ranges",
+			want: []string{"Psalms 10:9-11", "Psalms 100:1-3", "John 3:9-11", "Jude 1:24-25", "Revelation 1:1-2"},
+		},
+		{
+			name:  "referenced passage first",
+			query: "John 3:16",
+			want:  []string{"John 3:16-18", "Psalms 10:9-11", "Psalms 100:1-3", "John 3:9-11", "Jude 1:24-25", "Revelation 1:1-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := DetectLocation(tt.query, corpus, ReferenceForce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			passages := FindPassages(scored(), loc, corpus, DefaultPassageOptions())
+
+			got := make([]string, len(passages))
+			for i, p := range passages {
+				got[i] = p.Location
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	passages := FindPassages(scored(), LocationStruct{}, corpus, DefaultPassageOptions())
+	for _, p := range passages {
+		if p.Location == "John 3:9-11" {
+			if want := "9 text of John 3:9 10 text of John 3:10 11 text of John 3:11"; p.Verse != want {
+				t.Errorf("John 3:9-11 text = %q, want %q", p.Verse, want)
+			}
+			if p.Similarity != 0.9 {
+				t.Errorf("John 3:9-11 score = %v, want 0.9", p.Similarity)
+			}
+		}
+	}
+}
+
+func TestFindPassagesAcrossChapters(t *testing.T) {
+	var verses []Embedding
+	for _, c := range []struct {
+		book            string
+		chapter, verses int
+	}{{"Ruth", 1, 22}, {"Ruth", 2, 23}, {"Esther", 1, 22}} {
+		for v := 1; v <= c.verses; v++ {
+			location := fmt.Sprintf("%s %d:%d", c.book, c.chapter, v)
+			verses = append(verses, Embedding{Location: location, Verse: "text of " + location})
+		}
+	}
+	corpus := NewCorpus(nil, verses)
+
+	// One run crossing a chapter break, and one crossing a book boundary.
+	strong := map[string]bool{
+		"Ruth 1:21": true, "Ruth 1:22": true, "Ruth 2:1": true, "Ruth 2:2": true,
+		"Ruth 2:23": true, "Esther 1:1": true,
+	}
+	scored := make([]Embedding, len(verses))
+	for i, e := range verses {
+		scored[i] = Embedding{Location: e.Location, Verse: e.Verse, Similarity: 0.1}
+		if strong[e.Location] {
+			scored[i].Similarity = 0.9
+		}
+	}
+
+	passages := FindPassages(scored, LocationStruct{}, corpus, DefaultPassageOptions())
+	got := make([]string, len(passages))
+	for i, p := range passages {
+		got[i] = p.Location
+	}
+	if want := []string{"Ruth 1:21-2:2", "Ruth 2:23", "Esther 1:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := "21 text of Ruth 1:21 22 text of Ruth 1:22 2:1 text of Ruth 2:1 2 text of Ruth 2:2"; passages[0].Verse != want {
+		t.Errorf("Ruth 1:21-2:2 text = %q, want %q", passages[0].Verse, want)
+	}
+
+	loc, err := DetectLocation("Ruth 1:22-2:1", corpus, ReferenceForce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passages = FindPassages(scored, loc, corpus, DefaultPassageOptions())
+	if len(passages) == 0 || passages[0].Location != "Ruth 1:22-2:1" || passages[0].Verse != "22 text of Ruth 1:22 2:1 text of Ruth 2:1" {
+		t.Errorf("referenced passage = %+v, want Ruth 1:22-2:1 first", passages)
+	}
+}
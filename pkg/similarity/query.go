@@ -0,0 +1,138 @@
+package similarity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a search query with its filters taken out. Text is what is
+// embedded and matched; Filter restricts what it is matched against.
+//
+// The syntax, in any order:
+//
+//	book:John           only this book; several as book:Matthew,John
+//	books:Romans-Jude   a range of books in canonical order
+//	testament:NT        OT or NT
+//	chapter:3           only this chapter of each book
+//	"living water"      a phrase the text must contain (and is searched for)
+//	-hate, -"an eye"    a word or phrase the text must not contain
+//
+// Book names with spaces are quoted, book:"Song of Solomon", or joined with
+// underscores, book:Song_of_Solomon.
+type Query struct {
+	Text   string
+	Filter Filter
+}
+
+// QueryError is a token of a query that is not a valid filter.
+type QueryError struct {
+	Token string
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %s", e.Token, e.Msg)
+}
+
+// ParseQuery separates the filters of raw from its text.
+func ParseQuery(raw string) (Query, error) {
+	tokens, err := splitQuery(raw)
+	if err != nil {
+		return Query{}, err
+	}
+
+	var q Query
+	var words []string
+	for _, tok := range tokens {
+		switch {
+		case len(tok) > 1 && tok[0] == '-':
+			q.Filter.Excluded = append(q.Filter.Excluded, unquote(tok[1:]))
+		case tok[0] == '"':
+			phrase := unquote(tok)
+			q.Filter.Phrases = append(q.Filter.Phrases, phrase)
+			words = append(words, phrase)
+		default:
+			key, value, isFilter := filterToken(tok)
+			if !isFilter {
+				words = append(words, tok)
+				continue
+			}
+			if err := q.Filter.apply(key, unquote(value)); err != nil {
+				return Query{}, &QueryError{Token: tok, Msg: err.Error()}
+			}
+		}
+	}
+	q.Text = strings.Join(words, " ")
+	return q, nil
+}
+
+// filterKeys are the keys that make a "key:value" token a filter.
+var filterKeys = map[string]bool{"book": true, "books": true, "testament": true, "chapter": true}
+
+// filterToken splits a "key:value" token. Only a known key makes a filter, so
+// references such as "3:16" and words such as "time:now" stay part of the text.
+func filterToken(tok string) (key string, value string, ok bool) {
+	colon := strings.IndexByte(tok, ':')
+	if colon <= 0 || colon == len(tok)-1 {
+		return "", "", false
+	}
+	key = strings.ToLower(tok[:colon])
+	if !filterKeys[key] {
+		return "", "", false
+	}
+	return key, tok[colon+1:], true
+}
+
+func (f *Filter) apply(key string, value string) error {
+	switch key {
+	case "book", "books":
+		return f.SetBooks(value)
+	case "testament":
+		return f.SetTestament(value)
+	case "chapter":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("chapter must be a positive integer")
+		}
+		*f = f.And(Filter{Chapter: n})
+	}
+	return nil
+}
+
+// splitQuery splits raw on spaces outside double quotes, keeping the quotes.
+func splitQuery(raw string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	quoteStart := 0
+	for i, r := range raw {
+		switch {
+		case r == '"':
+			if !quoted {
+				quoteStart = i
+			}
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, &QueryError{Token: raw[quoteStart:], Msg: "unterminated quote"}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+func unquote(s string) string {
+	return strings.TrimSpace(strings.ReplaceAll(s, `"`, ""))
+}
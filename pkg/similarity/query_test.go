@@ -0,0 +1,39 @@
+package similarity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		raw      string
+		text     string
+		filtered bool
+	}{
+		{raw: "grace book:Romans", text: "grace", filtered: true},
+		{raw: "love Chapter:13 testament:NT", text: "love", filtered: true},
+		{raw: "hope time:now", text: "hope time:now"},
+		{raw: "John 3:16", text: "John 3:16"},
+		{raw: `"living water" -thirst`, text: "living water", filtered: true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.raw)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.raw, err)
+			continue
+		}
+		if q.Text != tt.text || q.Filter.IsEmpty() == tt.filtered {
+			t.Errorf("ParseQuery(%q) = text %q, filtered %v; want %q, %v", tt.raw, q.Text, !q.Filter.IsEmpty(), tt.text, tt.filtered)
+		}
+	}
+}
+
+func TestParseQueryInvalidFilter(t *testing.T) {
+	for _, raw := range []string{"grace book:Nowhere", "love chapter:zero", "faith testament:XT", `"unterminated`} {
+		var queryErr *QueryError
+		if _, err := ParseQuery(raw); !errors.As(err, &queryErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want a QueryError", raw, err)
+		}
+	}
+}
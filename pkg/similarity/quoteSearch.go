@@ -0,0 +1,161 @@
+package similarity
+
+import (
+	"go-scripture/pkg/quote"
+	"strconv"
+	"strings"
+)
+
+const (
+	// QuoteConfidence is the quote score above which a query is taken to be a
+	// quotation and searched as one instead of semantically.
+	QuoteConfidence = 0.8
+	// minQuoteScore drops alignments too loose to call a quote at all.
+	minQuoteScore = 0.5
+	// minQuoteWords is the shortest query tried as a quotation when not asked
+	// for explicitly; shorter ones match too much by chance.
+	minQuoteWords = 4
+	// quoteDepth is how many verses a quote search aligns and ranks.
+	quoteDepth = 200
+)
+
+// Span is the matched part of a result's text, as byte offsets.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// QuoteMatch is a verse, or two adjacent verses, quoting the query. For two
+// verses Location covers both and Verse is their texts joined by a space.
+type QuoteMatch struct {
+	Embedding
+	Span Span
+}
+
+// FindQuotes looks for query as a possibly misremembered quotation of verse
+// text. It returns the requested page of matches, best first, and the number
+// scoring at least opts.MinScore.
+func FindQuotes(query string, corpus *Corpus, opts SearchOptions) ([]QuoteMatch, int) {
+	return pageOfQuotes(quoteMatches(query, corpus, opts.Filter), opts)
+}
+
+// MatchQuote reports whether query, whose reference if any is loc, reads as a
+// quotation rather than a topic or a reference, and if so returns its confident
+// matches as FindQuotes would.
+func MatchQuote(query string, loc LocationStruct, corpus *Corpus, opts SearchOptions) ([]QuoteMatch, int, bool) {
+	if len(strings.Fields(query)) < minQuoteWords || loc.HasLocation {
+		return nil, 0, false
+	}
+	matches := quoteMatches(query, corpus, opts.Filter)
+	if len(matches) == 0 || matches[0].Similarity < QuoteConfidence {
+		return nil, 0, false
+	}
+	if opts.MinScore < QuoteConfidence {
+		opts.MinScore = QuoteConfidence
+	}
+	found, total := pageOfQuotes(matches, opts)
+	return found, total, true
+}
+
+// quoteMatches returns the matches for query that filter allows, judging a
+// two-verse match by the location of its first verse and their joined text.
+func quoteMatches(query string, corpus *Corpus, filter Filter) []QuoteMatch {
+	cf := filter.compile(corpus.Versification)
+	var matches []QuoteMatch
+	for _, m := range corpus.Quotes.Find(query, quoteDepth) {
+		if m.Score < minQuoteScore {
+			break
+		}
+		first, last := corpus.Verses[m.Docs[0]], corpus.Verses[m.Docs[len(m.Docs)-1]]
+		e := first
+		if len(m.Docs) > 1 {
+			e.Verse = first.Verse + " " + last.Verse
+		}
+		if !cf.allows(e) {
+			continue
+		}
+		if len(m.Docs) > 1 {
+			e.Location = spanLocation(first.Location, last.Location)
+		}
+		e.Similarity = m.Score
+		matches = append(matches, QuoteMatch{Embedding: e, Span: Span{Start: m.Start, End: m.End}})
+	}
+	return matches
+}
+
+func pageOfQuotes(matches []QuoteMatch, opts SearchOptions) ([]QuoteMatch, int) {
+	var kept []QuoteMatch
+	for _, m := range matches {
+		if m.Similarity >= opts.MinScore {
+			kept = append(kept, m)
+		}
+	}
+	if opts.Offset >= len(kept) {
+		return []QuoteMatch{}, len(kept)
+	}
+	page := kept[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(page) {
+		page = page[:opts.Limit]
+	}
+	return page, len(kept)
+}
+
+// buildQuoteIndex indexes the text of verses for quote search, linking each
+// verse to the one after it in the same book.
+func buildQuoteIndex(verses []Embedding) *quote.Index {
+	positions := make(map[string]int, len(verses))
+	for i, e := range verses {
+		positions[e.Location] = i
+	}
+	next := make([]int, len(verses))
+	for i, e := range verses {
+		next[i] = -1
+		book, chapter, verse, ok := splitVerseLocation(e.Location)
+		if !ok {
+			continue
+		}
+		if j, ok := positions[verseLocation(book, chapter, verse+1)]; ok {
+			next[i] = j
+		} else if j, ok := positions[verseLocation(book, chapter+1, 1)]; ok {
+			next[i] = j
+		}
+	}
+	return quote.Build(textsOf(verses), next)
+}
+
+// spanLocation names the range from one verse location to a later one in the
+// same book: "Psalms 23:1-2" or "Psalms 23:6-24:1".
+func spanLocation(first, last string) string {
+	_, firstChapter, _, _ := splitVerseLocation(first)
+	_, lastChapter, lastVerse, ok := splitVerseLocation(last)
+	if !ok {
+		return first
+	}
+	if lastChapter == firstChapter {
+		return first + "-" + strconv.Itoa(lastVerse)
+	}
+	return first + "-" + strconv.Itoa(lastChapter) + ":" + strconv.Itoa(lastVerse)
+}
+
+// splitVerseLocation splits a dataset location such as "1 John 3:16" without
+// resolving the book name, so it works for any naming the dataset uses.
+func splitVerseLocation(location string) (book string, chapter int, verse int, ok bool) {
+	colon := strings.LastIndexByte(location, ':')
+	if colon < 0 {
+		return "", 0, 0, false
+	}
+	space := strings.LastIndexByte(location[:colon], ' ')
+	if space < 0 {
+		return "", 0, 0, false
+	}
+	chapter, err1 := strconv.Atoi(location[space+1 : colon])
+	verse, err2 := strconv.Atoi(location[colon+1:])
+	if err1 != nil || err2 != nil {
+		return "", 0, 0, false
+	}
+	return location[:space], chapter, verse, true
+}
+
+func verseLocation(book string, chapter int, verse int) string {
+	return book + " " + strconv.Itoa(chapter) + ":" + strconv.Itoa(verse)
+}
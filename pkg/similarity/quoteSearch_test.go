@@ -0,0 +1,117 @@
+package similarity
+
+import "testing"
+
+// newQuoteCorpus builds a corpus of Psalm 23 and the verse after it, with no
+// vectors.
+func newQuoteCorpus() *Corpus {
+	texts := []struct{ location, text string }{
+		{"Psalms 23:1", "The LORD is my shepherd; I shall not want."},
+		{"Psalms 23:2", "He maketh me to lie down in green pastures: he leadeth me beside the still waters."},
+		{"Psalms 23:3", "He restoreth my soul: he leadeth me in the paths of righteousness for his name's sake."},
+		{"Psalms 23:4", "Yea, though I walk through the valley of the shadow of death, I will fear no evil: for thou art with me; thy rod and thy staff they comfort me."},
+		{"Psalms 23:5", "Thou preparest a table before me in the presence of mine enemies: thou anointest my head with oil; my cup runneth over."},
+		{"Psalms 23:6", "Surely goodness and mercy shall follow me all the days of my life: and I will dwell in the house of the LORD for ever."},
+		{"Psalms 24:1", "The earth is the LORD's, and the fulness thereof; the world, and they that dwell therein."},
+	}
+	verses := make([]Embedding, len(texts))
+	for i, v := range texts {
+		verses[i] = Embedding{Location: v.location, Verse: v.text, Index: i}
+	}
+	return NewCorpus(nil, verses)
+}
+
+func TestFindQuotes(t *testing.T) {
+	corpus := newQuoteCorpus()
+	found, total := FindQuotes("the lord is my shepard i shall not want", corpus, SearchOptions{Limit: 10})
+	if total == 0 || len(found) == 0 {
+		t.Fatal("got no matches")
+	}
+	m := found[0]
+	if m.Location != "Psalms 23:1" {
+		t.Errorf("Location = %q, want Psalms 23:1", m.Location)
+	}
+	if got, want := m.Verse[m.Span.Start:m.Span.End], "The LORD is my shepherd; I shall not want"; got != want {
+		t.Errorf("span = %q, want %q", got, want)
+	}
+	if m.Similarity < QuoteConfidence {
+		t.Errorf("Similarity = %v, want at least %v", m.Similarity, QuoteConfidence)
+	}
+}
+
+func TestMatchQuote(t *testing.T) {
+	corpus := newQuoteCorpus()
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"quotation", "yea though i walk thru the valley of the shadow of death", true},
+		{"too short", "my cup runneth", false},
+		{"topic", "comfort in times of grief and loss", false},
+		{"reference", "Psalms 23:4 the valley of the shadow", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := SearchOptions{Limit: 10, ReferenceMode: ReferenceAuto}
+			loc, err := DetectLocation(tt.query, corpus, opts.ReferenceMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found, _, ok := MatchQuote(tt.query, loc, corpus, opts)
+			if ok != tt.want {
+				t.Fatalf("ok = %v, want %v", ok, tt.want)
+			}
+			for _, m := range found {
+				if m.Similarity < QuoteConfidence {
+					t.Errorf("%s scored %v, below QuoteConfidence", m.Location, m.Similarity)
+				}
+			}
+		})
+	}
+}
+
+func TestSpanLocation(t *testing.T) {
+	tests := []struct {
+		first, last string
+		want        string
+	}{
+		{"Psalms 23:1", "Psalms 23:2", "Psalms 23:1-2"},
+		{"Psalms 23:6", "Psalms 24:1", "Psalms 23:6-24:1"},
+		{"1 John 3:16", "1 John 3:17", "1 John 3:16-17"},
+		{"Psalms 23:6", "Psalms", "Psalms 23:6"},
+	}
+	for _, tt := range tests {
+		if got := spanLocation(tt.first, tt.last); got != tt.want {
+			t.Errorf("spanLocation(%q, %q) = %q, want %q", tt.first, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteMatchesAcrossVerses(t *testing.T) {
+	corpus := newQuoteCorpus()
+	query := "dwell in the house of the lord for ever the earth is the lords"
+
+	matches := quoteMatches(query, corpus, Filter{})
+	if len(matches) == 0 {
+		t.Fatal("got no matches")
+	}
+	m := matches[0]
+	if m.Location != "Psalms 23:6-24:1" {
+		t.Errorf("Location = %q, want Psalms 23:6-24:1", m.Location)
+	}
+	if got, want := m.Verse[m.Span.Start:m.Span.End], "dwell in the house of the LORD for ever. The earth is the LORD"; got != want {
+		t.Errorf("span = %q, want %q", got, want)
+	}
+
+	// The match is judged by its first verse, so a filter on Psalm 24 drops it.
+	filter, err := ParseQuery("chapter:24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range quoteMatches(query, corpus, filter.Filter) {
+		if m.Location == "Psalms 23:6-24:1" {
+			t.Errorf("chapter:24 kept %s", m.Location)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package similarity
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// SearchOptions controls which of the scored results a search returns.
+type SearchOptions struct {
+	// UseIndex allows verse and chapter searches to use the ANN index.
+	UseIndex bool
+	// Limit is the number of results returned after Offset; 0 returns them all.
+	Limit  int
+	Offset int
+	// MinScore drops results scoring below it.
+	MinScore float64
+	// ReferenceMode controls whether a reference in the query overrides
+	// semantic search.
+	ReferenceMode ReferenceMode
+	// Mode chooses semantic or hybrid ranking of verses; Fusion and Alpha
+	// control how hybrid rankings are combined.
+	Mode   SearchMode
+	Fusion FusionMethod
+	Alpha  float64
+	// Filter restricts the candidates scored.
+	Filter Filter
+	// Diversity re-ranks the best results to spread them out.
+	Diversity Diversity
+}
+
+// DefaultSearchOptions returns the first 50 semantic results with no score
+// cut-off, honouring only confidently detected references.
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		UseIndex:      true,
+		Limit:         50,
+		MinScore:      -1,
+		ReferenceMode: ReferenceAuto,
+		Mode:          ModeSemantic,
+		Fusion:        FusionRRF,
+		Alpha:         0.5,
+	}
+}
+
+// matchHeap is a min-heap on Similarity, so the weakest of the current top k
+// is always at the root.
+type matchHeap []Match
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return h[i].Similarity < h[j].Similarity }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+// selectTopMatches returns the k best matches scoring at least minScore, in
+// descending order, along with how many matches met minScore in total. It runs
+// in O(n log k) instead of sorting every match. k <= 0 keeps every match.
+func selectTopMatches(matches []Match, k int, minScore float64) ([]Match, int) {
+	total := 0
+	if k <= 0 {
+		var kept []Match
+		for _, m := range matches {
+			if m.Similarity >= minScore {
+				kept = append(kept, m)
+			}
+		}
+		sortMatches(kept)
+		return kept, len(kept)
+	}
+
+	h := make(matchHeap, 0, k)
+	for _, m := range matches {
+		if m.Similarity < minScore {
+			continue
+		}
+		total++
+		if len(h) < k {
+			heap.Push(&h, m)
+		} else if m.Similarity > h[0].Similarity {
+			h[0] = m
+			heap.Fix(&h, 0)
+		}
+	}
+
+	top := make([]Match, len(h))
+	for i := len(top) - 1; i >= 0; i-- {
+		top[i] = heap.Pop(&h).(Match)
+	}
+	return top, total
+}
+
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+}
+
+// Paginate applies opts' MinScore, Diversity, Offset and Limit to results that
+// are already sorted by descending Similarity, returning the page and the
+// number of results meeting MinScore. A diversified search only ranks the best
+// results, so the number is of those it ranked.
+func Paginate(results []Embedding, opts SearchOptions) ([]Embedding, int) {
+	var kept []Embedding
+	for _, e := range results {
+		if e.Similarity >= opts.MinScore {
+			kept = append(kept, e)
+		}
+	}
+	if !opts.Diversity.IsEmpty() {
+		kept = diversified(kept, opts)
+	}
+	return pageOf(kept, opts.Offset, opts.Limit), len(kept)
+}
+
+// diversified ranks the best of results as opts.Diversity does.
+func diversified(results []Embedding, opts SearchOptions) []Embedding {
+	if depth := opts.Diversity.depth(opts.Offset + opts.Limit); len(results) > depth {
+		results = results[:depth]
+	}
+	order := opts.Diversity.diversify(results)
+	ranked := make([]Embedding, len(order))
+	for i, j := range order {
+		ranked[i] = results[j]
+	}
+	return ranked
+}
+
+func pageOf(results []Embedding, offset int, limit int) []Embedding {
+	if offset >= len(results) {
+		return []Embedding{}
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,106 @@
+package similarity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func matchesScoring(scores ...float64) []Match {
+	matches := make([]Match, len(scores))
+	for i, s := range scores {
+		matches[i] = Match{Index: i, Similarity: s}
+	}
+	return matches
+}
+
+func TestSelectTopMatches(t *testing.T) {
+	matches := matchesScoring(0.2, 0.9, -0.5, 0.7, 0.4, 0.9, 0.1)
+	tests := []struct {
+		name      string
+		k         int
+		minScore  float64
+		want      []float64
+		wantTotal int
+	}{
+		{"top 3", 3, -1, []float64{0.9, 0.9, 0.7}, 7},
+		{"k of 0 keeps all", 0, -1, []float64{0.9, 0.9, 0.7, 0.4, 0.2, 0.1, -0.5}, 7},
+		{"negative k keeps all", -5, -1, []float64{0.9, 0.9, 0.7, 0.4, 0.2, 0.1, -0.5}, 7},
+		{"k past n", 20, -1, []float64{0.9, 0.9, 0.7, 0.4, 0.2, 0.1, -0.5}, 7},
+		{"min score", 2, 0.3, []float64{0.9, 0.9}, 4},
+		{"min score keeps all", 0, 0.3, []float64{0.9, 0.9, 0.7, 0.4}, 4},
+		{"min score is inclusive", 10, 0.4, []float64{0.9, 0.9, 0.7, 0.4}, 4},
+		{"nothing meets min score", 3, 1, []float64{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top, total := selectTopMatches(matches, tt.k, tt.minScore)
+			got := []float64{}
+			for _, m := range top {
+				got = append(got, m.Similarity)
+				if matches[m.Index] != m {
+					t.Errorf("match %+v lost its index", m)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) || total != tt.wantTotal {
+				t.Errorf("got %v, %d; want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	var results []Embedding
+	for _, s := range []float64{0.9, 0.8, 0.7, 0.6, 0.5} {
+		results = append(results, Embedding{Similarity: s})
+	}
+	tests := []struct {
+		name      string
+		opts      SearchOptions
+		want      []float64
+		wantTotal int
+	}{
+		{"first page", SearchOptions{Limit: 2, MinScore: -1}, []float64{0.9, 0.8}, 5},
+		{"second page", SearchOptions{Limit: 2, Offset: 2, MinScore: -1}, []float64{0.7, 0.6}, 5},
+		{"short last page", SearchOptions{Limit: 2, Offset: 4, MinScore: -1}, []float64{0.5}, 5},
+		{"no limit", SearchOptions{Offset: 1, MinScore: -1}, []float64{0.8, 0.7, 0.6, 0.5}, 5},
+		{"offset at the end", SearchOptions{Limit: 2, Offset: 5, MinScore: -1}, []float64{}, 5},
+		{"offset past the end", SearchOptions{Limit: 2, Offset: 50, MinScore: -1}, []float64{}, 5},
+		{"min score", SearchOptions{Limit: 10, MinScore: 0.75}, []float64{0.9, 0.8}, 2},
+		{"offset past min score", SearchOptions{Limit: 10, Offset: 2, MinScore: 0.75}, []float64{}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := Paginate(results, tt.opts)
+			got := []float64{}
+			for _, e := range page {
+				got = append(got, e.Similarity)
+			}
+			if !reflect.DeepEqual(got, tt.want) || total != tt.wantTotal {
+				t.Errorf("got %v, %d; want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestFindSimilaritiesPages(t *testing.T) {
+	corpus, embedder := newTestCorpus(t)
+	opts := SearchOptions{MinScore: -1}
+	all, total, err := FindSimilarities("grace and truth", LocationStruct{}, corpus, embedder, "verse", nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(corpus.Verses) || total != len(corpus.Verses) {
+		t.Fatalf("got %d results and a total of %d, want %d", len(all), total, len(corpus.Verses))
+	}
+
+	opts.Limit, opts.Offset = 10, 25
+	page, total, _ := FindSimilarities("grace and truth", LocationStruct{}, corpus, embedder, "verse", nil, opts)
+	if !reflect.DeepEqual(page, all[25:35]) || total != len(all) {
+		t.Errorf("page at offset 25 is not results 25-34 of the full ranking")
+	}
+
+	opts.Offset = len(all)
+	if page, total, _ := FindSimilarities("grace and truth", LocationStruct{}, corpus, embedder, "verse", nil, opts); len(page) != 0 || total != len(all) {
+		t.Errorf("offset past the end returned %d results and a total of %d", len(page), total)
+	}
+}
@@ -0,0 +1,87 @@
+package similarity
+
+import "strings"
+
+// Translations is the registry of loaded translations, each with its own
+// corpus. The first translation added is the default unless SetDefault picks
+// another.
+type Translations struct {
+	ids       []string
+	corpora   map[string]*Corpus
+	defaultID string
+}
+
+// TranslationInfo describes a loaded translation for /translations.
+type TranslationInfo struct {
+	ID string `json:"id"`
+	// VectorsFrom is the translation whose embeddings are searched.
+	VectorsFrom string `json:"vectors_from"`
+	Verses      int    `json:"verses"`
+	Chapters    int    `json:"chapters"`
+	Default     bool   `json:"default"`
+}
+
+func NewTranslations() *Translations {
+	return &Translations{corpora: make(map[string]*Corpus)}
+}
+
+// Add registers corpus under id, which is matched case-insensitively.
+func (t *Translations) Add(id string, corpus *Corpus) {
+	id = strings.ToUpper(id)
+	corpus.Translation = id
+	if corpus.VectorsFrom == "" {
+		corpus.VectorsFrom = id
+	}
+	if _, exists := t.corpora[id]; !exists {
+		t.ids = append(t.ids, id)
+	}
+	t.corpora[id] = corpus
+	if t.defaultID == "" {
+		t.defaultID = id
+	}
+}
+
+// SetDefault makes id the default translation, if it is loaded.
+func (t *Translations) SetDefault(id string) bool {
+	id = strings.ToUpper(id)
+	if _, ok := t.corpora[id]; !ok {
+		return false
+	}
+	t.defaultID = id
+	return true
+}
+
+// Get returns the corpus of translation id, or of the default translation when
+// id is empty.
+func (t *Translations) Get(id string) (*Corpus, bool) {
+	if id == "" {
+		id = t.defaultID
+	}
+	corpus, ok := t.corpora[strings.ToUpper(id)]
+	return corpus, ok
+}
+
+// Default returns the default translation's corpus, or nil if none is loaded.
+func (t *Translations) Default() *Corpus {
+	return t.corpora[t.defaultID]
+}
+
+// IDs lists the loaded translations in the order they were added.
+func (t *Translations) IDs() []string {
+	return append([]string(nil), t.ids...)
+}
+
+func (t *Translations) List() []TranslationInfo {
+	infos := make([]TranslationInfo, len(t.ids))
+	for i, id := range t.ids {
+		c := t.corpora[id]
+		infos[i] = TranslationInfo{
+			ID:          id,
+			VectorsFrom: c.VectorsFrom,
+			Verses:      len(c.VerseMap),
+			Chapters:    len(c.Chapters),
+			Default:     id == t.defaultID,
+		}
+	}
+	return infos
+}